@@ -1,31 +1,38 @@
 package api
 
 import (
-	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/feralc/golang-sp-2024-eventsourcing/application/service"
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/repository"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	HeaderETag    = "ETag"
+	HeaderIfMatch = "If-Match"
+)
+
 func CreateShoppingCartHandler(svc *service.ShoppingCartService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		ctx := context.Background()
-		cartID, err := svc.CreateShoppingCart(ctx)
+		ctx := c.Request().Context()
+		cartID, version, err := svc.CreateShoppingCart(ctx)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
-		return c.JSON(http.StatusCreated, map[string]string{"cartID": cartID})
+		setETag(c, version)
+		return c.JSON(http.StatusCreated, map[string]interface{}{"cartID": cartID, "version": version})
 	}
 }
 
 func AddItemHandler(svc *service.ShoppingCartService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		ctx := context.Background()
+		ctx := c.Request().Context()
 		cartID := c.Param("cartID")
 
 		data := echo.Map{}
@@ -36,38 +43,60 @@ func AddItemHandler(svc *service.ShoppingCartService) echo.HandlerFunc {
 		productID := fmt.Sprintf("%v", data["product_id"])
 		quantity, _ := strconv.Atoi(fmt.Sprintf("%v", data["quantity"]))
 
-		err := svc.AddItem(ctx, cartID, productID, quantity)
+		expectedVersion, err := ifMatchVersion(c)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		version, err := svc.AddItem(ctx, cartID, productID, quantity, expectedVersion)
+		if err != nil {
+			return c.JSON(errorStatusCode(err), map[string]string{"error": err.Error()})
 		}
-		return c.NoContent(http.StatusOK)
+		return versionResponse(c, version)
 	}
 }
 
 func RemoveItemHandler(svc *service.ShoppingCartService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		ctx := context.Background()
+		ctx := c.Request().Context()
 		cartID := c.Param("cartID")
 		productID := c.Param("productID")
 
-		err := svc.RemoveItem(ctx, cartID, productID)
+		expectedVersion, err := ifMatchVersion(c)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		version, err := svc.RemoveItem(ctx, cartID, productID, expectedVersion)
+		if err != nil {
+			return c.JSON(errorStatusCode(err), map[string]string{"error": err.Error()})
 		}
-		return c.NoContent(http.StatusOK)
+		return versionResponse(c, version)
 	}
 }
 
 func CheckoutHandler(svc *service.ShoppingCartService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		ctx := context.Background()
+		ctx := c.Request().Context()
 		cartID := c.Param("cartID")
 
-		err := svc.Checkout(ctx, cartID)
+		data := struct {
+			Customer entity.Customer `json:"customer"`
+		}{}
+		if err := c.Bind(&data); err != nil {
+			return err
+		}
+
+		expectedVersion, err := ifMatchVersion(c)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 		}
-		return c.NoContent(http.StatusOK)
+
+		version, err := svc.Checkout(ctx, cartID, data.Customer, expectedVersion)
+		if err != nil {
+			return c.JSON(errorStatusCode(err), map[string]string{"error": err.Error()})
+		}
+		return versionResponse(c, version)
 	}
 }
 
@@ -79,77 +108,23 @@ func GetShoppingCartHandler(cartRepo repository.ShoppingCartRepository) echo.Han
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "Shopping cart not found"})
 		}
 
+		setETag(c, cart.Version())
 		return c.JSON(http.StatusOK, NewShoppingCartViewModel(cart))
 	}
 }
 
-func GetAllShoppingCartsHandler(db *sql.DB) echo.HandlerFunc {
+func GetAllShoppingCartsHandler(cartReadRepo repository.ShoppingCartReadRepository) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		query := `
-			SELECT
-				c.cart_id,
-				c.total,
-				c.created_at,
-				i.product_id,
-				i.name,
-				i.quantity,
-				i.price
-			FROM
-				shopping_cart c
-			LEFT JOIN
-				shopping_cart_item i ON c.cart_id = i.cart_id
-		`
-
-		rows, err := db.Query(query)
+		carts, err := cartReadRepo.All(c.Request().Context())
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 				"error": "Failed to query database",
 			})
 		}
-		defer rows.Close()
-
-		carts := map[string]ShoppingCartViewModel{}
-		for rows.Next() {
-			var cartID string
-			var total sql.NullFloat64
-			var price sql.NullFloat64
-			var quantity sql.NullInt32
-			var createdAtCart string
-			var productID sql.NullString
-			var productName sql.NullString
-
-			if err := rows.Scan(&cartID, &total, &createdAtCart, &productID, &productName, &quantity, &price); err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-					"error": fmt.Sprintf("Failed to scan rows %s", err),
-				})
-			}
-
-			_, ok := carts[cartID]
-			if !ok {
-				carts[cartID] = ShoppingCartViewModel{
-					CartID: cartID,
-					Total:  total.Float64,
-					Items:  []ShoppingCartItemViewModel{},
-				}
-			}
-
-			cart := carts[cartID]
-
-			if productID.Valid {
-				cart.Items = append(cart.Items, ShoppingCartItemViewModel{
-					ProductID: productID.String,
-					Name:      productName.String,
-					Price:     price.Float64,
-					Quantity:  int(quantity.Int32),
-					Total:     price.Float64 * float64(quantity.Int32),
-				})
-				carts[cartID] = cart
-			}
-		}
 
-		response := []ShoppingCartViewModel{}
-		for _, cart := range carts {
-			response = append(response, cart)
+		response := make([]ShoppingCartViewModel, len(carts))
+		for i, cart := range carts {
+			response[i] = NewShoppingCartViewModelFromView(cart)
 		}
 
 		return c.JSON(http.StatusOK, response)
@@ -168,3 +143,48 @@ func GetAllProductsHandler(productRepo repository.ProductRepository) echo.Handle
 		return c.JSON(http.StatusOK, products)
 	}
 }
+
+func errorStatusCode(err error) int {
+	if errors.Is(err, service.ErrConcurrencyConflict) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, service.ErrVersionMismatch) {
+		return http.StatusPreconditionFailed
+	}
+
+	if errors.Is(err, entity.CartCustomerIDRequiredError) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// setETag exposes the cart version as the response ETag, which clients send
+// back in If-Match to only update the cart if it was not changed meanwhile.
+func setETag(c echo.Context, version int64) {
+	c.Response().Header().Set(HeaderETag, strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+func versionResponse(c echo.Context, version int64) error {
+	setETag(c, version)
+	return c.JSON(http.StatusOK, map[string]int64{"version": version})
+}
+
+// ifMatchVersion returns the cart version of the If-Match header, or nil when
+// the request is not conditional.
+func ifMatchVersion(c echo.Context) (*int64, error) {
+	header := strings.TrimSpace(c.Request().Header.Get(HeaderIfMatch))
+
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid If-Match header %q", header)
+	}
+
+	return &version, nil
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderCorrelationID = "X-Correlation-ID"
+	HeaderUserID        = "X-User-ID"
+)
+
+// EventMetadataMiddleware stores the request correlation ID, request ID and
+// user ID in the request context, so every event appended while handling the
+// request can be traced back to it.
+func EventMetadataMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			requestID := c.Request().Header.Get(echo.HeaderXRequestID)
+			if requestID == "" {
+				requestID = uuid.Must(uuid.NewV4()).String()
+			}
+
+			correlationID := c.Request().Header.Get(HeaderCorrelationID)
+			if correlationID == "" {
+				correlationID = requestID
+			}
+
+			ctx := esourcing.WithEventMetadata(c.Request().Context(), esourcing.EventMetadata{
+				CorrelationID: correlationID,
+				CausationID:   requestID,
+				UserID:        c.Request().Header.Get(HeaderUserID),
+			})
+
+			c.SetRequest(c.Request().WithContext(ctx))
+			c.Response().Header().Set(HeaderCorrelationID, correlationID)
+
+			return next(c)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package api
 
-import "github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
+import (
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/repository"
+)
 
 type ShoppingCartItemViewModel struct {
 	ProductID string  `json:"product_id"`
@@ -11,9 +14,11 @@ type ShoppingCartItemViewModel struct {
 }
 
 type ShoppingCartViewModel struct {
-	CartID string                      `json:"cart_id"`
-	Total  float64                     `json:"total"`
-	Items  []ShoppingCartItemViewModel `json:"items"`
+	CartID   string                      `json:"cart_id"`
+	Version  int64                       `json:"version"`
+	Total    float64                     `json:"total"`
+	Items    []ShoppingCartItemViewModel `json:"items"`
+	Customer *entity.Customer            `json:"customer,omitempty"`
 }
 
 func NewShoppingCartViewModel(cart *entity.ShoppingCart) ShoppingCartViewModel {
@@ -29,9 +34,36 @@ func NewShoppingCartViewModel(cart *entity.ShoppingCart) ShoppingCartViewModel {
 		}
 	}
 
+	viewModel := ShoppingCartViewModel{
+		CartID:  cart.CartID(),
+		Version: cart.Version(),
+		Total:   cart.Total(),
+		Items:   items,
+	}
+
+	if customer := cart.Customer(); customer.ID != "" {
+		viewModel.Customer = &customer
+	}
+
+	return viewModel
+}
+
+func NewShoppingCartViewModelFromView(cart repository.ShoppingCartView) ShoppingCartViewModel {
+	items := make([]ShoppingCartItemViewModel, len(cart.Items))
+
+	for i, item := range cart.Items {
+		items[i] = ShoppingCartItemViewModel{
+			ProductID: item.ProductID,
+			Name:      item.Name,
+			Price:     item.Price,
+			Quantity:  item.Quantity,
+			Total:     item.Price * float64(item.Quantity),
+		}
+	}
+
 	return ShoppingCartViewModel{
-		CartID: cart.CartID(),
-		Total:  cart.Total(),
+		CartID: cart.CartID,
+		Total:  cart.Total,
 		Items:  items,
 	}
 }
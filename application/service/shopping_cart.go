@@ -2,11 +2,21 @@ package service
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/repository"
+	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
 )
 
+// ErrConcurrencyConflict is returned when the cart was changed by another
+// request between being loaded and saved. Callers may retry the operation.
+var ErrConcurrencyConflict = esourcing.ErrConcurrencyConflict
+
+// ErrVersionMismatch is returned by conditional updates when the cart is no
+// longer at the version the caller expected.
+var ErrVersionMismatch = fmt.Errorf("shopping cart version mismatch")
+
 type ShoppingCartService struct {
 	cartRepository    repository.ShoppingCartRepository
 	productRepository repository.ProductRepository
@@ -19,56 +29,91 @@ func NewShoppingCartService(cartRepository repository.ShoppingCartRepository, pr
 	}
 }
 
-func (s *ShoppingCartService) CreateShoppingCart(ctx context.Context) (cartID string, err error) {
+func (s *ShoppingCartService) CreateShoppingCart(ctx context.Context) (cartID string, version int64, err error) {
 	cartID = s.cartRepository.NextIdentity()
 
-	cart := entity.NewShoppingCart(cartID)
+	cart := entity.NewShoppingCart(ctx, cartID)
 
 	err = s.cartRepository.Save(ctx, cart)
 
-	return cart.CartID(), err
+	return cart.CartID(), cart.Version(), err
 }
 
-func (s *ShoppingCartService) AddItem(ctx context.Context, cartID string, productID string, quantity int) error {
-	cart, err := s.cartRepository.FindByID(ctx, cartID)
+func (s *ShoppingCartService) AddItem(ctx context.Context, cartID string, productID string, quantity int, expectedVersion *int64) (version int64, err error) {
+	cart, err := s.findByVersion(ctx, cartID, expectedVersion)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	product, err := s.productRepository.FindByID(ctx, productID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if err := cart.AddItem(product.ProductID, product.Name, product.Price, quantity); err != nil {
-		return err
+	if err := cart.AddItem(ctx, product.ProductID, product.Name, product.Price, quantity); err != nil {
+		return 0, err
 	}
 
-	return s.cartRepository.Save(ctx, cart)
+	err = s.cartRepository.Save(ctx, cart)
+
+	return cart.Version(), err
 }
 
-func (s *ShoppingCartService) RemoveItem(ctx context.Context, cartID string, productID string) error {
-	cart, err := s.cartRepository.FindByID(ctx, cartID)
+func (s *ShoppingCartService) RemoveItem(ctx context.Context, cartID string, productID string, expectedVersion *int64) (version int64, err error) {
+	cart, err := s.findByVersion(ctx, cartID, expectedVersion)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if err := cart.RemoveItem(productID); err != nil {
-		return err
+	if err := cart.RemoveItem(ctx, productID); err != nil {
+		return 0, err
+	}
+
+	err = s.cartRepository.Save(ctx, cart)
+
+	return cart.Version(), err
+}
+
+func (s *ShoppingCartService) Checkout(ctx context.Context, cartID string, customer entity.Customer, expectedVersion *int64) (version int64, err error) {
+	cart, err := s.findByVersion(ctx, cartID, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := cart.Checkout(ctx, customer); err != nil {
+		return 0, err
 	}
 
-	return s.cartRepository.Save(ctx, cart)
+	err = s.cartRepository.Save(ctx, cart)
+
+	return cart.Version(), err
 }
 
-func (s *ShoppingCartService) Checkout(ctx context.Context, cartID string) error {
+// PurgeShoppingCart records the deletion of the cart and then deletes its
+// stream permanently.
+func (s *ShoppingCartService) PurgeShoppingCart(ctx context.Context, cartID string, reason string) error {
 	cart, err := s.cartRepository.FindByID(ctx, cartID)
 	if err != nil {
 		return err
 	}
 
-	if err := cart.Checkout(); err != nil {
-		return err
+	cart.Delete(ctx, reason)
+
+	return s.cartRepository.Purge(ctx, cart)
+}
+
+// findByVersion loads the cart and, when expectedVersion is set, checks that it
+// is still at that version. The repository then rejects the save if the cart is
+// changed again before it is written.
+func (s *ShoppingCartService) findByVersion(ctx context.Context, cartID string, expectedVersion *int64) (*entity.ShoppingCart, error) {
+	cart, err := s.cartRepository.FindByID(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != nil && cart.Version() != *expectedVersion {
+		return nil, fmt.Errorf("%w: cart %s is at version %d, expected %d", ErrVersionMismatch, cartID, cart.Version(), *expectedVersion)
 	}
 
-	return s.cartRepository.Save(ctx, cart)
+	return cart, nil
 }
@@ -0,0 +1,10 @@
+package entity
+
+// Customer checks a shopping cart out. The name and email are personal data,
+// encrypted in the events and snapshots of the cart with the key of the
+// customer ID.
+type Customer struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/event"
@@ -11,6 +13,7 @@ var CartMaxCapacityReachedError = fmt.Errorf("shopping cart max capacity reached
 var CartInvalidQuantityError = fmt.Errorf("shopping cart invalid quantity")
 var CartItemNotFoundError = fmt.Errorf("shopping cart item not found")
 var CartIsEmptyError = fmt.Errorf("shopping cart is empty")
+var CartCustomerIDRequiredError = fmt.Errorf("shopping cart customer id required")
 
 const CART_CAPACITY = 5
 
@@ -20,24 +23,40 @@ const ShoppingCartAggregateType = esourcing.AggregateType("shopping_cart")
 
 type ShoppingCart struct {
 	*esourcing.AggregateRoot
-	cartID CartID
-	items  []ShoppingCartItem
-	total  float64
+	cartID   CartID
+	items    []ShoppingCartItem
+	total    float64
+	customer Customer
 }
 
-func NewShoppingCart(cartID string) *ShoppingCart {
+func NewShoppingCart(ctx context.Context, cartID string) *ShoppingCart {
+	cart := NewEmptyShoppingCart(cartID)
+
+	esourcing.AppendEvent(ctx, cart, event.ShoppingCartCreated{
+		CartID: cartID,
+	})
+
+	return cart
+}
+
+// NewEmptyShoppingCart returns a cart without any event, to be rebuilt from
+// its stream by the repository.
+func NewEmptyShoppingCart(cartID string) *ShoppingCart {
 	cart := &ShoppingCart{
 		AggregateRoot: esourcing.NewAggregateRoot(ShoppingCartAggregateType, cartID),
 	}
 
-	esourcing.AppendEvent(cart, event.ShoppingCartCreated{
-		CartID: cartID,
-	})
+	esourcing.On(cart, cart.onCreated)
+	esourcing.On(cart, cart.onItemAdded)
+	esourcing.On(cart, cart.onItemRemoved)
+	esourcing.On(cart, cart.onCheckedOut)
+	esourcing.On(cart, cart.onDeleted)
+	cart.RejectUnhandledEvents()
 
 	return cart
 }
 
-func (cart *ShoppingCart) AddItem(productID string, name string, price float64, quantity int) error {
+func (cart *ShoppingCart) AddItem(ctx context.Context, productID string, name string, price float64, quantity int) error {
 	if len(cart.items)+1 > CART_CAPACITY {
 		return CartMaxCapacityReachedError
 	}
@@ -46,7 +65,7 @@ func (cart *ShoppingCart) AddItem(productID string, name string, price float64,
 		return CartInvalidQuantityError
 	}
 
-	esourcing.AppendEvent(cart, event.ShoppingCartItemAdded{
+	esourcing.AppendEvent(ctx, cart, event.ShoppingCartItemAdded{
 		ProductID: productID,
 		Name:      name,
 		Price:     price,
@@ -56,28 +75,46 @@ func (cart *ShoppingCart) AddItem(productID string, name string, price float64,
 	return nil
 }
 
-func (cart *ShoppingCart) RemoveItem(productID string) error {
+func (cart *ShoppingCart) RemoveItem(ctx context.Context, productID string) error {
 	if !cart.HasItem(productID) {
 		return CartItemNotFoundError
 	}
 
-	esourcing.AppendEvent(cart, event.ShoppingCartItemRemoved{
+	esourcing.AppendEvent(ctx, cart, event.ShoppingCartItemRemoved{
 		ProductID: productID,
 	})
 
 	return nil
 }
 
-func (cart *ShoppingCart) Checkout() error {
+// Checkout records the customer checking the cart out. The customer is
+// optional, but its details need an ID, the subject of their encryption.
+func (cart *ShoppingCart) Checkout(ctx context.Context, customer Customer) error {
 	if cart.IsEmpty() {
 		return CartIsEmptyError
 	}
 
-	esourcing.AppendEvent(cart, event.ShoppingCartCheckedOut{})
+	if customer.ID == "" && (customer.Name != "" || customer.Email != "") {
+		return CartCustomerIDRequiredError
+	}
+
+	esourcing.AppendEvent(ctx, cart, event.ShoppingCartCheckedOut{
+		CustomerID:    customer.ID,
+		CustomerName:  customer.Name,
+		CustomerEmail: customer.Email,
+	})
 
 	return nil
 }
 
+// Delete records why the cart is deleted. The repository deletes its stream
+// once the event is saved.
+func (cart *ShoppingCart) Delete(ctx context.Context, reason string) {
+	esourcing.AppendEvent(ctx, cart, event.ShoppingCartDeleted{
+		Reason: reason,
+	})
+}
+
 func (cart *ShoppingCart) CartID() string {
 	return string(cart.cartID)
 }
@@ -86,6 +123,12 @@ func (cart *ShoppingCart) Total() float64 {
 	return cart.total
 }
 
+// Customer returns who checked the cart out, with empty details once the
+// customer was forgotten.
+func (cart *ShoppingCart) Customer() Customer {
+	return cart.customer
+}
+
 func (cart *ShoppingCart) HasItem(productID string) bool {
 	return cart.FindItem(productID) != nil
 }
@@ -107,37 +150,93 @@ func (cart *ShoppingCart) IsEmpty() bool {
 	return len(cart.items) == 0
 }
 
-func (cart *ShoppingCart) ApplyEvent(e esourcing.Event) {
-	switch evt := e.(type) {
-	case event.ShoppingCartCreated:
-		cart.cartID = CartID(evt.CartID)
-		cart.items = []ShoppingCartItem{}
-
-	case event.ShoppingCartItemAdded:
-		if existingItem := cart.FindItem(evt.ProductID); existingItem != nil {
-			existingItem.Quantity += evt.Quantity
-			cart.total += evt.Price * float64(evt.Quantity)
-		} else {
-			item := ShoppingCartItem{
-				ProductID: evt.ProductID,
-				Name:      evt.Name,
-				Price:     evt.Price,
-				Quantity:  evt.Quantity,
-			}
-			cart.items = append(cart.items, item)
-			cart.total += item.Total()
-		}
+type shoppingCartSnapshot struct {
+	CartID        string             `json:"cart_id"`
+	Items         []ShoppingCartItem `json:"items"`
+	Total         float64            `json:"total"`
+	CustomerID    string             `json:"customer_id,omitempty" pii:"subject"`
+	CustomerName  string             `json:"customer_name,omitempty" pii:"data"`
+	CustomerEmail string             `json:"customer_email,omitempty" pii:"data"`
+}
+
+func (cart *ShoppingCart) Snapshot() ([]byte, error) {
+	return json.Marshal(shoppingCartSnapshot{
+		CartID:        cart.CartID(),
+		Items:         cart.items,
+		Total:         cart.total,
+		CustomerID:    cart.customer.ID,
+		CustomerName:  cart.customer.Name,
+		CustomerEmail: cart.customer.Email,
+	})
+}
 
-	case event.ShoppingCartItemRemoved:
-		for idx, item := range cart.items {
-			if item.ProductID == evt.ProductID {
-				cart.items = append(cart.items[:idx], cart.items[idx+1:]...)
-				cart.total -= item.Total()
-			}
+// NewSnapshotState makes the repository encrypt the customer details of the
+// snapshots, like those of the events.
+func (cart *ShoppingCart) NewSnapshotState() interface{} {
+	return &shoppingCartSnapshot{}
+}
+
+func (cart *ShoppingCart) RestoreSnapshot(state []byte) error {
+	var snapshot shoppingCartSnapshot
+
+	if err := json.Unmarshal(state, &snapshot); err != nil {
+		return err
+	}
+
+	cart.cartID = CartID(snapshot.CartID)
+	cart.items = snapshot.Items
+	cart.total = snapshot.Total
+	cart.customer = Customer{
+		ID:    snapshot.CustomerID,
+		Name:  snapshot.CustomerName,
+		Email: snapshot.CustomerEmail,
+	}
+
+	return nil
+}
+
+func (cart *ShoppingCart) onCreated(evt event.ShoppingCartCreated) {
+	cart.cartID = CartID(evt.CartID)
+	cart.items = []ShoppingCartItem{}
+}
+
+func (cart *ShoppingCart) onItemAdded(evt event.ShoppingCartItemAdded) {
+	if existingItem := cart.FindItem(evt.ProductID); existingItem != nil {
+		existingItem.Quantity += evt.Quantity
+		cart.total += evt.Price * float64(evt.Quantity)
+		return
+	}
+
+	item := ShoppingCartItem{
+		ProductID: evt.ProductID,
+		Name:      evt.Name,
+		Price:     evt.Price,
+		Quantity:  evt.Quantity,
+	}
+	cart.items = append(cart.items, item)
+	cart.total += item.Total()
+}
+
+func (cart *ShoppingCart) onItemRemoved(evt event.ShoppingCartItemRemoved) {
+	for idx, item := range cart.items {
+		if item.ProductID == evt.ProductID {
+			cart.items = append(cart.items[:idx], cart.items[idx+1:]...)
+			cart.total -= item.Total()
 		}
+	}
+}
 
-	case event.ShoppingCartCheckedOut:
-		cart.items = []ShoppingCartItem{}
-		cart.total = 0
+func (cart *ShoppingCart) onCheckedOut(evt event.ShoppingCartCheckedOut) {
+	cart.items = []ShoppingCartItem{}
+	cart.total = 0
+	cart.customer = Customer{
+		ID:    evt.CustomerID,
+		Name:  evt.CustomerName,
+		Email: evt.CustomerEmail,
 	}
 }
+
+func (cart *ShoppingCart) onDeleted(evt event.ShoppingCartDeleted) {
+	cart.items = []ShoppingCartItem{}
+	cart.total = 0
+}
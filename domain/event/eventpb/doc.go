@@ -0,0 +1,5 @@
+// Package eventpb holds the protobuf payloads of the events encoded as
+// protobuf, generated from the .proto files of this directory.
+package eventpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative shopping_cart_item_added.proto
@@ -0,0 +1,47 @@
+package event
+
+import "github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+
+// Stable names the shopping cart events are stored under. They must never
+// change; when a struct is renamed or moved keep its name here, and when a
+// name has to change keep the previous one as an alias on registration.
+const (
+	ShoppingCartCreatedName     = "ShoppingCartCreated"
+	ShoppingCartItemAddedName   = "ShoppingCartItemAdded"
+	ShoppingCartItemRemovedName = "ShoppingCartItemRemoved"
+	ShoppingCartCheckedOutName  = "ShoppingCartCheckedOut"
+	ShoppingCartDeletedName     = "ShoppingCartDeleted"
+)
+
+var registrations = []struct {
+	eventType esourcing.EventType
+	name      string
+}{
+	{(*ShoppingCartCreated)(nil), ShoppingCartCreatedName},
+	{(*ShoppingCartItemAdded)(nil), ShoppingCartItemAddedName},
+	{(*ShoppingCartItemRemoved)(nil), ShoppingCartItemRemovedName},
+	{(*ShoppingCartCheckedOut)(nil), ShoppingCartCheckedOutName},
+	{(*ShoppingCartDeleted)(nil), ShoppingCartDeletedName},
+}
+
+// RegisterEventTypes registers the shopping cart events in the store.
+func RegisterEventTypes(store esourcing.EventStore) error {
+	for _, registration := range registrations {
+		if err := store.RegisterEventType(registration.eventType, registration.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShoppingCartEventTypes lists the events the shopping cart can emit.
+func ShoppingCartEventTypes() []esourcing.EventType {
+	eventTypes := make([]esourcing.EventType, len(registrations))
+
+	for i, registration := range registrations {
+		eventTypes[i] = registration.eventType
+	}
+
+	return eventTypes
+}
@@ -3,7 +3,10 @@ package event
 import "github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
 
 type ShoppingCartCheckedOut struct {
-	*esourcing.EventBase
+	esourcing.EventBase
+	CustomerID    string `json:"customer_id,omitempty" pii:"subject"`
+	CustomerName  string `json:"customer_name,omitempty" pii:"data"`
+	CustomerEmail string `json:"customer_email,omitempty" pii:"data"`
 }
 
 func (e ShoppingCartCheckedOut) Version() string {
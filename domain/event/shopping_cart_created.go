@@ -3,7 +3,7 @@ package event
 import "github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
 
 type ShoppingCartCreated struct {
-	*esourcing.EventBase
+	esourcing.EventBase
 	CartID string `json:"cart_id"`
 }
 
@@ -0,0 +1,12 @@
+package event
+
+import "github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+
+type ShoppingCartDeleted struct {
+	esourcing.EventBase
+	Reason string `json:"reason"`
+}
+
+func (e ShoppingCartDeleted) Version() string {
+	return "v1"
+}
@@ -1,9 +1,15 @@
 package event
 
-import "github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+import (
+	"fmt"
+
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/event/eventpb"
+	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+	"google.golang.org/protobuf/proto"
+)
 
 type ShoppingCartItemAdded struct {
-	*esourcing.EventBase
+	esourcing.EventBase
 	ProductID string  `json:"product_id"`
 	Name      string  `json:"name"`
 	Price     float64 `json:"price"`
@@ -13,3 +19,29 @@ type ShoppingCartItemAdded struct {
 func (e ShoppingCartItemAdded) Version() string {
 	return "v1"
 }
+
+// MarshalProto encodes the event as eventpb.ShoppingCartItemAdded, generated
+// from eventpb/shopping_cart_item_added.proto.
+func (e ShoppingCartItemAdded) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&eventpb.ShoppingCartItemAdded{
+		ProductId: e.ProductID,
+		Name:      e.Name,
+		Price:     e.Price,
+		Quantity:  int64(e.Quantity),
+	})
+}
+
+func (e *ShoppingCartItemAdded) UnmarshalProto(b []byte) error {
+	var message eventpb.ShoppingCartItemAdded
+
+	if err := proto.Unmarshal(b, &message); err != nil {
+		return fmt.Errorf("invalid ShoppingCartItemAdded payload: %w", err)
+	}
+
+	e.ProductID = message.ProductId
+	e.Name = message.Name
+	e.Price = message.Price
+	e.Quantity = int(message.Quantity)
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package event
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/event/eventpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestShoppingCartItemAddedProtoRoundTrip(t *testing.T) {
+	added := ShoppingCartItemAdded{ProductID: "123", Name: "Book", Price: 12.5, Quantity: 3}
+
+	data, err := added.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var message eventpb.ShoppingCartItemAdded
+
+	if err := proto.Unmarshal(data, &message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.ProductId != "123" || message.Name != "Book" || message.Price != 12.5 || message.Quantity != 3 {
+		t.Fatalf("unexpected message %v", &message)
+	}
+
+	var decoded ShoppingCartItemAdded
+
+	if err := decoded.UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, added) {
+		t.Fatalf("expected %+v, got %+v", added, decoded)
+	}
+
+	if err := decoded.UnmarshalProto([]byte{0xff}); err == nil {
+		t.Fatal("expected an invalid payload to fail")
+	}
+}
+
+// TestShoppingCartItemAddedMatchesProtoSchema checks that every payload field
+// of the event has a field in the .proto schema, named like its JSON field,
+// and the other way around.
+func TestShoppingCartItemAddedMatchesProtoSchema(t *testing.T) {
+	fields := (&eventpb.ShoppingCartItemAdded{}).ProtoReflect().Descriptor().Fields()
+	eventType := reflect.TypeOf(ShoppingCartItemAdded{})
+	payloadFields := 0
+
+	for i := 0; i < eventType.NumField(); i++ {
+		field := eventType.Field(i)
+
+		if field.Anonymous {
+			continue
+		}
+
+		payloadFields++
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if fields.ByName(protoreflect.Name(name)) == nil {
+			t.Errorf("field %s of the event is missing from the proto schema", name)
+		}
+	}
+
+	if fields.Len() != payloadFields {
+		t.Errorf("expected the proto schema to have %d fields, got %d", payloadFields, fields.Len())
+	}
+}
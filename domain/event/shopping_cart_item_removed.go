@@ -3,7 +3,7 @@ package event
 import "github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
 
 type ShoppingCartItemRemoved struct {
-	*esourcing.EventBase
+	esourcing.EventBase
 	ProductID string `json:"product_id"`
 }
 
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+)
+
+// ShoppingCartView is a shopping cart as read from the read model.
+type ShoppingCartView struct {
+	CartID string
+	Total  float64
+	Items  []ShoppingCartItemView
+}
+
+type ShoppingCartItemView struct {
+	ProductID string
+	Name      string
+	Price     float64
+	Quantity  int
+}
+
+// ShoppingCartReadRepository queries the shopping cart read model, which is
+// eventually consistent with the carts.
+type ShoppingCartReadRepository interface {
+	All(ctx context.Context) ([]ShoppingCartView, error)
+}
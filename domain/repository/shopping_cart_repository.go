@@ -9,5 +9,10 @@ import (
 type ShoppingCartRepository interface {
 	Save(ctx context.Context, cart *entity.ShoppingCart) error
 	FindByID(ctx context.Context, cartID string) (*entity.ShoppingCart, error)
+	// Delete saves the pending events of the cart and deletes it. Saving the
+	// cart again brings it back.
+	Delete(ctx context.Context, cart *entity.ShoppingCart) error
+	// Purge saves the pending events of the cart and deletes it permanently.
+	Purge(ctx context.Context, cart *entity.ShoppingCart) error
 	NextIdentity() string
 }
@@ -1,6 +1,7 @@
 package esourcing
 
 import (
+	"context"
 	"reflect"
 	"sync"
 	"time"
@@ -22,21 +23,32 @@ type Aggregate interface {
 	SetUncommittedEvents(events []Event)
 	ClearUncommittedEvents()
 	GetAndClearUncommitedEvents() []Event
+	StreamRevision() int64
+	SetStreamRevision(revision int64)
+	Version() int64
+	OriginalVersion() int64
 }
 
+// NoStreamRevision is the stream revision of an aggregate that was never persisted.
+const NoStreamRevision int64 = -1
+
 type AggregateRoot struct {
 	id                string
 	aggregateType     AggregateType
 	events            []Event
 	uncommittedEvents []Event
+	streamRevision    int64
+	handlers          map[reflect.Type]func(event Event)
+	strict            bool
 	mu                *sync.Mutex
 }
 
 func NewAggregateRoot(aggregateType AggregateType, aggregateID string) *AggregateRoot {
 	return &AggregateRoot{
-		id:            aggregateID,
-		aggregateType: aggregateType,
-		mu:            &sync.Mutex{},
+		id:             aggregateID,
+		aggregateType:  aggregateType,
+		streamRevision: NoStreamRevision,
+		mu:             &sync.Mutex{},
 	}
 }
 
@@ -56,6 +68,28 @@ func (a *AggregateRoot) SetEvents(events []Event) {
 	a.events = events
 }
 
+// StreamRevision returns the revision of the last event persisted in the
+// aggregate stream, or NoStreamRevision when the aggregate was never saved.
+func (a *AggregateRoot) StreamRevision() int64 {
+	return a.streamRevision
+}
+
+func (a *AggregateRoot) SetStreamRevision(revision int64) {
+	a.streamRevision = revision
+}
+
+// Version returns the sequence number of the last event applied to the
+// aggregate, including uncommitted ones, or NoStreamRevision when there is none.
+func (a *AggregateRoot) Version() int64 {
+	return a.streamRevision + int64(len(a.UncommittedEvents()))
+}
+
+// OriginalVersion returns the version the aggregate was loaded or last saved
+// at, which is the version the stream is expected to be at on the next save.
+func (a *AggregateRoot) OriginalVersion() int64 {
+	return a.streamRevision
+}
+
 func (a *AggregateRoot) SetUncommittedEvents(events []Event) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -82,38 +116,56 @@ func (a *AggregateRoot) GetAndClearUncommitedEvents() []Event {
 	return events
 }
 
-func AppendEvent(agg Aggregate, event Event) {
-	// v is the interface{}
-	v := reflect.ValueOf(&event).Elem()
-
-	// Allocate a temporary variable with type of the struct
-	// v.Elem() is the vale contained in the interface
-	tmp := reflect.New(v.Elem().Type()).Elem()
-
-	// Copy the struct value contained in interface to
-	// the temporary variable
-	tmp.Set(v.Elem())
-
-	eventType := tmp.Type().Name()
-	baseEvent := NewEventBaseForAggregate(agg.AggregateType(), agg.AggregateID(), eventType, time.Now())
-	tmp.FieldByName("EventBase").Set(reflect.ValueOf(baseEvent))
-
-	// Set the interface to the modified struct value
-	v.Set(tmp)
+// AppendEvent records the event as uncommitted on the aggregate and applies it.
+// The event metadata (correlation, causation, user and custom values) is taken
+// from ctx, see WithEventMetadata. Events must embed EventBase.
+func AppendEvent[E Event, P eventPointer[E]](ctx context.Context, agg Aggregate, event E) {
+	baseEvent := NewEventBaseForAggregate(agg.AggregateType(), agg.AggregateID(), eventTypeName[E](), time.Now())
+	baseEvent.sequence = agg.Version() + 1
+	baseEvent.metadata = eventMetadataFor(ctx, baseEvent.eventID)
+	P(&event).setEventBase(baseEvent)
 
 	agg.SetUncommittedEvents(append(agg.UncommittedEvents(), event))
 	agg.ApplyEvent(event)
 }
 
+// ExpectedRevisionFor returns the revision the aggregate stream must be at for
+// its uncommitted events to be appended without conflicting with other writers.
+func ExpectedRevisionFor(agg Aggregate) ExpectedRevision {
+	if agg.OriginalVersion() == NoStreamRevision {
+		return NoStream{}
+	}
+
+	return Revision(uint64(agg.OriginalVersion()))
+}
+
 func Commit(a Aggregate) {
 	a.SetEvents(append(a.Events(), a.UncommittedEvents()...))
 	a.ClearUncommittedEvents()
 }
 
-func RebuildFromEvents(a Aggregate, events []Event) {
+// RebuildFromEvents replaces the state of the aggregate with the given events.
+// It fails on the first event without handler when the aggregate rejects
+// unhandled events.
+func RebuildFromEvents(a Aggregate, events []Event) error {
 	a.SetEvents(events)
+	a.SetStreamRevision(lastRevision(events, NoStreamRevision))
 
 	for _, e := range events {
-		a.ApplyEvent(e)
+		if err := applyEvent(a, e); err != nil {
+			return err
+		}
 	}
+
+	return nil
+}
+
+// lastRevision returns the stream revision of the last event, which is past
+// the event count when the stream was soft-deleted and appended to again.
+func lastRevision(events []Event, otherwise int64) int64 {
+	if len(events) == 0 {
+		return otherwise
+	}
+
+	return events[len(events)-1].SequenceNumber()
 }
@@ -0,0 +1,183 @@
+package esourcing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const benchmarkStreamLength = 2000
+
+// newBenchmarkStream returns a store holding a counter stream of
+// benchmarkStreamLength events.
+func newBenchmarkStream(b *testing.B) EventStore {
+	b.Helper()
+
+	store := NewInMemoryEventStore()
+	registerCounterEvents(b, store)
+
+	by := make([]int, benchmarkStreamLength)
+
+	for i := range by {
+		by[i] = i
+	}
+
+	if _, err := store.AppendToStream(context.Background(), "counter#1", NoStream{}, incrementEvents("1", by...)); err != nil {
+		b.Fatal(err)
+	}
+
+	return store
+}
+
+// appendEventReflect is AppendEvent as it was before it became generic,
+// finding the EventBase field by name, kept as the baseline of
+// BenchmarkAppendEvent.
+func appendEventReflect(ctx context.Context, agg Aggregate, event Event) {
+	v := reflect.ValueOf(&event).Elem()
+	tmp := reflect.New(v.Elem().Type()).Elem()
+	tmp.Set(v.Elem())
+
+	baseEvent := NewEventBaseForAggregate(agg.AggregateType(), agg.AggregateID(), tmp.Type().Name(), time.Now())
+	baseEvent.sequence = agg.Version() + 1
+	baseEvent.metadata = eventMetadataFor(ctx, baseEvent.eventID)
+	tmp.FieldByName("EventBase").Set(reflect.ValueOf(baseEvent))
+	v.Set(tmp)
+
+	agg.SetUncommittedEvents(append(agg.UncommittedEvents(), event))
+	agg.ApplyEvent(event)
+}
+
+func BenchmarkAppendEvent(b *testing.B) {
+	cases := []struct {
+		name        string
+		appendEvent func(ctx context.Context, c *counter)
+	}{
+		{"reflect", func(ctx context.Context, c *counter) {
+			appendEventReflect(ctx, c, counterIncremented{By: 1})
+		}},
+		{"generic", func(ctx context.Context, c *counter) {
+			AppendEvent(ctx, c, counterIncremented{By: 1})
+		}},
+	}
+
+	for _, bc := range cases {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx := context.Background()
+			c := newCounter("1")
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				bc.appendEvent(ctx, c)
+
+				if i%1000 == 999 {
+					c.ClearUncommittedEvents()
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAppendToStream(b *testing.B) {
+	ctx := context.Background()
+	store := NewInMemoryEventStore()
+	registerCounterEvents(b, store)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		id := fmt.Sprint(i)
+
+		if _, err := store.AppendToStream(ctx, "counter#"+id, NoStream{}, incrementEvents(id, 1)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRebuildFromEvents(b *testing.B) {
+	events, err := newBenchmarkStream(b).ReadStream(context.Background(), "counter#1", ReadStreamOptions{From: Start{}}, benchmarkStreamLength)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := RebuildFromEvents(newCounter("1"), events); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadAndRebuild includes decoding the stored events, like loading an
+// aggregate without snapshot does.
+func BenchmarkReadAndRebuild(b *testing.B) {
+	ctx := context.Background()
+	store := newBenchmarkStream(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		events, err := ReadFullStream(ctx, store, "counter#1", ReadStreamOptions{From: Start{}}, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := RebuildFromEvents(newCounter("1"), events); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// counterReset has no handler on the counter.
+type counterReset struct {
+	EventBase
+}
+
+func (e counterReset) Version() string {
+	return "v1"
+}
+
+func TestAppendUnhandledEvent(t *testing.T) {
+	ctx := context.Background()
+
+	lenient := newCounter("1")
+	AppendEvent(ctx, lenient, counterReset{})
+
+	if len(lenient.UncommittedEvents()) != 1 {
+		t.Fatalf("expected the unhandled event to be recorded, got %d events", len(lenient.UncommittedEvents()))
+	}
+
+	strict := newCounter("2")
+	strict.RejectUnhandledEvents()
+
+	defer func() {
+		err, _ := recover().(error)
+
+		if !errors.Is(err, ErrUnhandledEvent) {
+			t.Fatalf("expected a panic with %v, got %v", ErrUnhandledEvent, err)
+		}
+	}()
+
+	AppendEvent(ctx, strict, counterReset{})
+}
+
+func TestRebuildFromUnhandledEvent(t *testing.T) {
+	events := append(incrementEvents("1", 1), counterReset{EventBase: NewEventBaseForAggregate(counterAggregateType, "1", "counterReset", time.Now())})
+
+	if err := RebuildFromEvents(newCounter("1"), events); err != nil {
+		t.Fatalf("expected the unhandled event to be skipped, got %v", err)
+	}
+
+	strict := newCounter("1")
+	strict.RejectUnhandledEvents()
+
+	if err := RebuildFromEvents(strict, events); !errors.Is(err, ErrUnhandledEvent) {
+		t.Fatalf("expected %v, got %v", ErrUnhandledEvent, err)
+	}
+}
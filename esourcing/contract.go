@@ -3,10 +3,7 @@ package esourcing
 import (
 	"context"
 	"database/sql"
-	"reflect"
 	"time"
-
-	"github.com/EventStore/EventStore-Client-Go/esdb"
 )
 
 type Event interface {
@@ -14,40 +11,142 @@ type Event interface {
 	EventType() string
 	Timestamp() time.Time
 	Version() string
+	SequenceNumber() int64
 	AggregateType() AggregateType
 	AggregateID() string
+	CorrelationID() string
+	CausationID() string
+	UserID() string
+	Metadata() map[string]string
 }
 
 type EventType interface{}
 
-type EventTypeRegistry map[string]reflect.Type
-
 type EventMarshaller interface {
-	ToEventData(event Event) (esdb.EventData, error)
-	FromRecordedEvent(recordedEvent *esdb.RecordedEvent) (Event, error)
+	ToEventData(ctx context.Context, event Event) (EventData, error)
+	FromRecordedEvent(ctx context.Context, recordedEvent *RecordedEvent) (Event, error)
+	RegisterUpcaster(upcaster EventUpcaster) error
+	ValidateUpcasters() error
+	RegisterSerializer(serializer EventSerializer)
+	UseSerializer(eventType string, contentType ContentType) error
+	EncryptPersonalData(keyStore KeyStore)
+	CompressPayloads(compressor PayloadCompressor, threshold int)
+}
+
+// PayloadCompressor compresses event payloads. Name is recorded in the event
+// metadata to pick the compressor back when reading. Only gzip is provided,
+// as the standard library has no zstd; a zstd compressor can be passed to
+// CompressPayloads from a third-party module.
+type PayloadCompressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// EventSerializer encodes event payloads in one content type. Unmarshal
+// receives a pointer to a zero value of the registered event struct.
+type EventSerializer interface {
+	ContentType() ContentType
+	Marshal(event Event) ([]byte, error)
+	Unmarshal(data []byte, event interface{}) error
 }
 
+// EventUpcaster transforms the stored payload of EventType from version From
+// to version To before it is decoded into the current event struct.
 type EventUpcaster struct {
-	From   string
-	To     string
-	Upcast func(data map[string]interface{}) map[string]interface{}
+	EventType string
+	From      string
+	To        string
+	Upcast    func(data map[string]interface{}) map[string]interface{}
 }
 
 type EventStore interface {
-	RegisterEventType(eventType EventType)
-	ReadStream(context context.Context, streamID string, options esdb.ReadStreamOptions, count uint64) (events []Event, err error)
+	RegisterEventType(eventType EventType, name string, aliases ...string) error
+	RegisteredEventTypes() []RegisteredEventType
+	ReadStream(context context.Context, streamID string, options ReadStreamOptions, count uint64) (events []Event, err error)
 	ReadLastEventFromStream(context context.Context, streamID string) (Event, error)
-	AppendToStream(context context.Context, streamID string, events []Event) (*esdb.WriteResult, error)
-	PersistentSubscribeToStream(ctx context.Context, streamName string, groupName string, options esdb.ConnectToPersistentSubscriptionOptions) (*esdb.PersistentSubscription, error)
-	CreatePersistentSubscription(ctx context.Context, streamName string, groupName string, options esdb.PersistentStreamSubscriptionOptions) error
-	SubscribeToAll(ctx context.Context, options esdb.SubscribeToAllOptions) (*esdb.Subscription, error)
-	SubscribeToStream(ctx context.Context, streamID string, options esdb.SubscribeToStreamOptions) (*esdb.Subscription, error)
-	DeleteStream(ctx context.Context, streamID string) error
+	// ReadAll reads up to count events of the global log matching the filter,
+	// skipping system events. Deleted streams keep their events in the log
+	// until the store scavenges them. It fails with UndecodableEventError on
+	// the first event that cannot be decoded.
+	ReadAll(ctx context.Context, options ReadAllOptions, count uint64) ([]ResolvedEvent, error)
+	AppendToStream(context context.Context, streamID string, expectedRevision ExpectedRevision, events []Event) (*WriteResult, error)
+	PersistentSubscribeToStream(ctx context.Context, streamName string, groupName string) (Subscription, error)
+	CreatePersistentSubscription(ctx context.Context, streamName string, groupName string, options PersistentSubscriptionOptions) error
+	SubscribeToAll(ctx context.Context, options SubscribeToAllOptions) (Subscription, error)
+	SubscribeToStream(ctx context.Context, streamID string, options SubscribeToStreamOptions) (Subscription, error)
+	// DeleteStream soft-deletes the stream: it reads as not found until new
+	// events are appended, which continue from its last revision.
+	DeleteStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error
+	// TombstoneStream hard-deletes the stream, which then fails reads and
+	// appends with StreamDeletedError.
+	TombstoneStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error
+	// GetStreamMetadata returns empty metadata when none was set.
+	GetStreamMetadata(ctx context.Context, streamID string) (*StreamMetadata, error)
+	// SetStreamMetadata replaces the metadata of the stream.
+	SetStreamMetadata(ctx context.Context, streamID string, metadata StreamMetadata) error
 	GetMarshaller() EventMarshaller
 }
 
+// KeyStore keeps the encryption key of each data subject. Forgetting a
+// subject deletes its key and records the subject, so no key is created for it
+// again. The personal data of its events can then no longer be decrypted and
+// is read back empty.
+type KeyStore interface {
+	// GetOrCreateKey returns ErrSubjectForgotten when the subject was forgotten.
+	GetOrCreateKey(ctx context.Context, subjectID string) ([]byte, error)
+	// GetKey returns ErrKeyNotFound when the subject has no key, and
+	// ErrSubjectForgotten when it was forgotten.
+	GetKey(ctx context.Context, subjectID string) ([]byte, error)
+	ForgetSubject(ctx context.Context, subjectID string) error
+}
+
+// Snapshotter is implemented by aggregates that can serialize their state, so
+// repositories can rehydrate them from a snapshot instead of their full stream.
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	RestoreSnapshot(state []byte) error
+}
+
+// PersonalDataSnapshotter is implemented by Snapshotter aggregates whose
+// snapshot state holds personal data. NewSnapshotState returns a pointer to a
+// zero value of the struct the state is encoded from as JSON, with the
+// personal data fields tagged like those of events. Repositories encrypt them
+// when the event marshaller encrypts personal data.
+type PersonalDataSnapshotter interface {
+	Snapshotter
+	NewSnapshotState() interface{}
+}
+
+type SnapshotStore interface {
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+	LoadSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) (*Snapshot, error)
+	DeleteSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) error
+}
+
+// SnapshotTombstoner is implemented by snapshot stores keeping snapshots in
+// streams, so the snapshot stream of a purged aggregate is tombstoned along
+// with the aggregate stream.
+type SnapshotTombstoner interface {
+	TombstoneSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) error
+}
+
+// SnapshotStreamMetadataSetter is implemented by snapshot stores keeping
+// snapshots in streams, so their streams get the metadata of the aggregate
+// streams.
+type SnapshotStreamMetadataSetter interface {
+	SetSnapshotStreamMetadata(ctx context.Context, aggregateType AggregateType, aggregateID string, metadata StreamMetadata) error
+}
+
+type Subscription interface {
+	Recv() *SubscriptionEvent
+	Close() error
+}
+
 type SubscriptionManager interface {
 	CreateSubscriptionIfNotExists(subscriptionID string) error
-	LastCheckpoint(subscriptionID string) (*esdb.Position, error)
-	SaveCheckpoint(subscriptionID string, position *esdb.Position, tx *sql.Tx) error
+	LastCheckpoint(subscriptionID string) (*Position, error)
+	SaveCheckpoint(subscriptionID string, position *Position, tx *sql.Tx) error
+	// ResetCheckpoint makes the subscription start over from the beginning.
+	ResetCheckpoint(subscriptionID string, tx *sql.Tx) error
 }
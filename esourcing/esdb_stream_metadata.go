@@ -0,0 +1,192 @@
+package esourcing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/esdb"
+)
+
+// The metadata of a stream is the last $metadata event of its $$ stream. It
+// is read and written here rather than through the client helpers, which
+// encode $maxAge in nanoseconds where EventStoreDB expects seconds.
+
+func (r *eventStore) GetStreamMetadata(ctx context.Context, streamID string) (*StreamMetadata, error) {
+	readStream, err := r.client.ReadStream(ctx, "$$"+streamID, esdb.ReadStreamOptions{
+		Direction: esdb.Backwards,
+		From:      esdb.End{},
+	}, 1)
+
+	if errors.Is(err, esdb.ErrStreamNotFound) || errors.Is(err, io.EOF) {
+		return &StreamMetadata{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error when reading metadata of stream %s: %w", streamID, err)
+	}
+
+	defer readStream.Close()
+
+	evt, err := readStream.Recv()
+
+	if errors.Is(err, io.EOF) {
+		return &StreamMetadata{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error when reading metadata of stream %s: %w", streamID, err)
+	}
+
+	var props map[string]interface{}
+
+	if err := json.Unmarshal(evt.OriginalEvent().Data, &props); err != nil {
+		return nil, fmt.Errorf("error when decoding metadata of stream %s: %w", streamID, err)
+	}
+
+	return fromEsdbStreamMetadata(props), nil
+}
+
+func (r *eventStore) SetStreamMetadata(ctx context.Context, streamID string, metadata StreamMetadata) error {
+	data, err := json.Marshal(toEsdbStreamMetadata(metadata))
+
+	if err != nil {
+		return fmt.Errorf("error when encoding metadata of stream %s: %w", streamID, err)
+	}
+
+	_, err = r.client.AppendToStream(ctx, "$$"+streamID, esdb.AppendToStreamOptions{ExpectedRevision: esdb.Any{}}, esdb.EventData{
+		ContentType: esdb.JsonContentType,
+		EventType:   "$metadata",
+		Data:        data,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error when writing metadata of stream %s: %w", streamID, err)
+	}
+
+	return nil
+}
+
+func toEsdbStreamMetadata(metadata StreamMetadata) map[string]interface{} {
+	props := map[string]interface{}{}
+
+	for key, value := range metadata.Custom {
+		props[key] = value
+	}
+
+	if metadata.MaxAge > 0 {
+		props["$maxAge"] = int64(metadata.MaxAge / time.Second)
+	}
+
+	if metadata.MaxCount > 0 {
+		props["$maxCount"] = metadata.MaxCount
+	}
+
+	if metadata.TruncateBefore > 0 {
+		props["$tb"] = metadata.TruncateBefore
+	}
+
+	if acl := metadata.ACL; acl != nil {
+		entries := map[string][]string{}
+
+		for key, roles := range map[string][]string{
+			"$r":  acl.ReadRoles,
+			"$w":  acl.WriteRoles,
+			"$d":  acl.DeleteRoles,
+			"$mr": acl.MetaReadRoles,
+			"$mw": acl.MetaWriteRoles,
+		} {
+			if len(roles) > 0 {
+				entries[key] = roles
+			}
+		}
+
+		props["$acl"] = entries
+	}
+
+	return props
+}
+
+func fromEsdbStreamMetadata(props map[string]interface{}) *StreamMetadata {
+	metadata := &StreamMetadata{}
+
+	for key, value := range props {
+		switch key {
+		case "$maxAge":
+			metadata.MaxAge = time.Duration(jsonUint64(value)) * time.Second
+		case "$maxCount":
+			metadata.MaxCount = jsonUint64(value)
+		case "$tb":
+			metadata.TruncateBefore = jsonUint64(value)
+		case "$acl":
+			metadata.ACL = fromEsdbACL(value)
+		default:
+			if strings.HasPrefix(key, "$") {
+				continue
+			}
+
+			if metadata.Custom == nil {
+				metadata.Custom = map[string]string{}
+			}
+
+			if s, ok := value.(string); ok {
+				metadata.Custom[key] = s
+			} else {
+				encoded, _ := json.Marshal(value)
+				metadata.Custom[key] = string(encoded)
+			}
+		}
+	}
+
+	return metadata
+}
+
+// fromEsdbACL reads an ACL object; the $userStreamAcl and $systemStreamAcl
+// shorthands are left to the server defaults.
+func fromEsdbACL(value interface{}) *StreamACL {
+	props, ok := value.(map[string]interface{})
+
+	if !ok {
+		return nil
+	}
+
+	return &StreamACL{
+		ReadRoles:      jsonRoles(props["$r"]),
+		WriteRoles:     jsonRoles(props["$w"]),
+		DeleteRoles:    jsonRoles(props["$d"]),
+		MetaReadRoles:  jsonRoles(props["$mr"]),
+		MetaWriteRoles: jsonRoles(props["$mw"]),
+	}
+}
+
+// jsonRoles reads an ACL entry, which is either a single role or a list.
+func jsonRoles(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		roles := make([]string, 0, len(value))
+
+		for _, role := range value {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+
+		return roles
+	}
+
+	return nil
+}
+
+func jsonUint64(value interface{}) uint64 {
+	if f, ok := value.(float64); ok && f > 0 {
+		return uint64(f)
+	}
+
+	return 0
+}
@@ -6,22 +6,27 @@ import (
 	"github.com/gofrs/uuid"
 )
 
+// EventBase holds the identity and metadata shared by every event. Event
+// structs embed it by value, which gives them the Event accessors and lets
+// AppendEvent and the marshaller fill it in without reflection.
 type EventBase struct {
 	eventID       string
 	eventType     string
 	timestamp     time.Time
 	aggregateType AggregateType
 	aggregateID   string
+	sequence      int64
+	metadata      EventMetadata
 }
 
-func NewEventBaseForAggregate(aggregateType AggregateType, aggregateID string, eventType string, timestamp time.Time) *EventBase {
+func NewEventBaseForAggregate(aggregateType AggregateType, aggregateID string, eventType string, timestamp time.Time) EventBase {
 	eventID, err := uuid.NewV4()
 
 	if err != nil {
 		panic(err)
 	}
 
-	return &EventBase{
+	return EventBase{
 		eventID:       eventID.String(),
 		eventType:     eventType,
 		timestamp:     timestamp,
@@ -30,28 +35,66 @@ func NewEventBaseForAggregate(aggregateType AggregateType, aggregateID string, e
 	}
 }
 
-func NewEventBaseForAggregateWithID(eventID string, aggregateType AggregateType, aggregateID string, eventType string, timestamp time.Time) *EventBase {
+func NewEventBaseForAggregateWithID(eventID string, aggregateType AggregateType, aggregateID string, eventType string, timestamp time.Time) EventBase {
 	event := NewEventBaseForAggregate(aggregateType, aggregateID, eventType, timestamp)
 	event.eventID = eventID
 	return event
 }
 
-func (e *EventBase) EventID() string {
+func (e EventBase) EventID() string {
 	return e.eventID
 }
 
-func (e *EventBase) EventType() string {
+func (e EventBase) EventType() string {
 	return e.eventType
 }
 
-func (e *EventBase) Timestamp() time.Time {
+func (e EventBase) Timestamp() time.Time {
 	return e.timestamp
 }
 
-func (e *EventBase) AggregateType() AggregateType {
+func (e EventBase) AggregateType() AggregateType {
 	return e.aggregateType
 }
 
-func (e *EventBase) AggregateID() string {
+func (e EventBase) AggregateID() string {
 	return e.aggregateID
 }
+
+// SequenceNumber is the position of the event within its aggregate stream,
+// starting at 0. It matches the stream revision the event is stored at.
+func (e EventBase) SequenceNumber() int64 {
+	return e.sequence
+}
+
+func (e EventBase) CorrelationID() string {
+	return e.metadata.CorrelationID
+}
+
+func (e EventBase) CausationID() string {
+	return e.metadata.CausationID
+}
+
+func (e EventBase) UserID() string {
+	return e.metadata.UserID
+}
+
+func (e EventBase) Metadata() map[string]string {
+	return e.metadata.Custom
+}
+
+func (e *EventBase) setEventBase(base EventBase) {
+	*e = base
+}
+
+// eventBaseSetter is implemented by pointers to structs embedding EventBase.
+type eventBaseSetter interface {
+	setEventBase(base EventBase)
+}
+
+// eventPointer constrains P to be a pointer to the event struct E, which must
+// embed EventBase.
+type eventPointer[E Event] interface {
+	*E
+	eventBaseSetter
+}
@@ -0,0 +1,52 @@
+package esourcing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type eventFilter struct {
+	filter *SubscriptionFilter
+	regex  *regexp.Regexp
+}
+
+// newEventFilter compiles a SubscriptionFilter for stores that have to match
+// events themselves instead of delegating the filtering to the server.
+func newEventFilter(filter *SubscriptionFilter) (*eventFilter, error) {
+	if filter == nil || filter.Regex == "" {
+		return &eventFilter{filter: filter}, nil
+	}
+
+	regex, err := regexp.Compile(strings.Trim(filter.Regex, "/"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription filter regex %s: %v", filter.Regex, err)
+	}
+
+	return &eventFilter{filter: filter, regex: regex}, nil
+}
+
+func (f *eventFilter) matches(recordedEvent *RecordedEvent) bool {
+	if f.filter == nil {
+		return true
+	}
+
+	value := recordedEvent.EventType
+
+	if f.filter.Type == StreamFilterType {
+		value = recordedEvent.StreamID
+	}
+
+	if f.regex != nil {
+		return f.regex.MatchString(value)
+	}
+
+	for _, prefix := range f.filter.Prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return len(f.filter.Prefixes) == 0
+}
@@ -0,0 +1,113 @@
+package esourcing
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrUnhandledEvent = fmt.Errorf("unhandled event")
+
+// eventHandlers is implemented by AggregateRoot and so by every aggregate
+// embedding it.
+type eventHandlers interface {
+	registerHandler(eventType reflect.Type, handler func(event Event))
+	handleEvent(event Event) error
+	hasHandlers() bool
+	hasHandler(eventType reflect.Type) bool
+}
+
+// On registers handler to apply events of type E to the aggregate, usually
+// from its constructor:
+//
+//	esourcing.On(cart, func(e event.ShoppingCartItemAdded) { ... })
+//
+// An aggregate with registered handlers no longer needs its own ApplyEvent.
+func On[E Event](agg eventHandlers, handler func(event E)) {
+	agg.registerHandler(reflect.TypeFor[E](), func(event Event) {
+		handler(event.(E))
+	})
+}
+
+func (a *AggregateRoot) registerHandler(eventType reflect.Type, handler func(event Event)) {
+	if a.handlers == nil {
+		a.handlers = map[reflect.Type]func(event Event){}
+	}
+
+	a.handlers[eventType] = handler
+}
+
+// RejectUnhandledEvents makes rehydration fail with ErrUnhandledEvent on events
+// the aggregate has no handler for, instead of skipping them, and AppendEvent
+// panic on them.
+func (a *AggregateRoot) RejectUnhandledEvents() {
+	a.strict = true
+}
+
+// ApplyEvent calls the handler registered for the event with On, if any. It
+// panics with ErrUnhandledEvent when the aggregate rejects unhandled events, as
+// recording an event the aggregate cannot apply is a programming error.
+func (a *AggregateRoot) ApplyEvent(event Event) {
+	if err := a.handleEvent(event); err != nil {
+		panic(err)
+	}
+}
+
+func (a *AggregateRoot) handleEvent(event Event) error {
+	handler, ok := a.handlers[reflect.TypeOf(event)]
+
+	if ok {
+		handler(event)
+		return nil
+	}
+
+	if a.strict {
+		return fmt.Errorf("%w: %s on %s %s", ErrUnhandledEvent, event.EventType(), a.aggregateType, a.id)
+	}
+
+	return nil
+}
+
+// applyEvent applies the event through the handlers registered with On, or
+// through the ApplyEvent of aggregates that do not register any.
+func applyEvent(a Aggregate, event Event) error {
+	if handlers, ok := a.(eventHandlers); ok && handlers.hasHandlers() {
+		return handlers.handleEvent(event)
+	}
+
+	a.ApplyEvent(event)
+
+	return nil
+}
+
+// VerifyHandlers checks that the aggregate registered a handler for each of the
+// given event types, e.g. (*ShoppingCartCreated)(nil), and is meant to run at
+// startup with every event the aggregate can emit.
+func VerifyHandlers(agg Aggregate, eventTypes ...EventType) error {
+	root, ok := agg.(eventHandlers)
+
+	if !ok {
+		return fmt.Errorf("aggregate %s does not embed AggregateRoot", agg.AggregateType())
+	}
+
+	var errs []error
+
+	for _, eventType := range eventTypes {
+		t := reflect.TypeOf(eventType).Elem()
+
+		if !root.hasHandler(t) {
+			errs = append(errs, fmt.Errorf("aggregate %s has no handler for event %s", agg.AggregateType(), t))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a *AggregateRoot) hasHandlers() bool {
+	return len(a.handlers) > 0
+}
+
+func (a *AggregateRoot) hasHandler(eventType reflect.Type) bool {
+	_, ok := a.handlers[eventType]
+	return ok
+}
@@ -1,110 +1,211 @@
 package esourcing
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
 	"time"
-
-	"github.com/EventStore/EventStore-Client-Go/esdb"
-	"github.com/gofrs/uuid"
 )
 
+// eventMetadataRecord is the metadata stored alongside every event payload.
+// The correlation and causation keys follow the EventStoreDB convention so
+// its $by_correlation_id projection picks them up.
+type eventMetadataRecord struct {
+	Version       string            `json:"version"`
+	ContentType   ContentType       `json:"content_type,omitempty"`
+	Compression   string            `json:"compression,omitempty"`
+	Encrypted     bool              `json:"encrypted,omitempty"`
+	AggregateType AggregateType     `json:"aggregate_type"`
+	AggregateID   string            `json:"aggregate_id"`
+	Timestamp     time.Time         `json:"timestamp"`
+	CorrelationID string            `json:"$correlationId,omitempty"`
+	CausationID   string            `json:"$causationId,omitempty"`
+	UserID        string            `json:"user_id,omitempty"`
+	Custom        map[string]string `json:"custom,omitempty"`
+}
+
 type eventMarshaller struct {
-	eventTypeRegistry EventTypeRegistry
+	eventTypeRegistry    *EventTypeRegistry
+	upcasters            map[string]map[string]EventUpcaster
+	serializers          map[ContentType]EventSerializer
+	eventContentTypes    map[string]ContentType
+	encryption           *personalDataEncryption
+	compressors          map[string]PayloadCompressor
+	compressor           PayloadCompressor
+	compressionThreshold int
 }
 
-func NewEventMarshaller(eventTypeRegistry EventTypeRegistry) EventMarshaller {
+func NewEventMarshaller(eventTypeRegistry *EventTypeRegistry) EventMarshaller {
 	return &eventMarshaller{
-		eventTypeRegistry,
+		eventTypeRegistry: eventTypeRegistry,
+		upcasters:         map[string]map[string]EventUpcaster{},
+		serializers: map[ContentType]EventSerializer{
+			JsonContentType: NewJsonSerializer(),
+		},
+		eventContentTypes: map[string]ContentType{},
+		compressors: map[string]PayloadCompressor{
+			"gzip": NewGzipCompressor(gzip.DefaultCompression),
+		},
 	}
 }
 
-func (em *eventMarshaller) ToEventData(event Event) (esdb.EventData, error) {
-	eventData, err := json.Marshal(event)
+func (em *eventMarshaller) ToEventData(ctx context.Context, event Event) (EventData, error) {
+	eventType, ok := em.eventTypeRegistry.NameOf(reflect.TypeOf(event))
+
+	if !ok {
+		eventType = event.EventType()
+	}
+
+	serializer := em.serializerFor(eventType)
+
+	// Only events recorded as encrypted are decrypted when read, the others
+	// were stored before encryption was enabled, or hold no personal data.
+	var encrypted bool
+
+	if em.encryption != nil {
+		var err error
+
+		event, encrypted, err = em.encryption.encrypt(ctx, event)
+
+		if err != nil {
+			return EventData{}, err
+		}
+	}
+
+	eventData, err := serializer.Marshal(event)
 
 	if err != nil {
-		return esdb.EventData{}, fmt.Errorf("error when marshalling event %v: %v", event.EventType(), err)
+		return EventData{}, fmt.Errorf("error when marshalling event %v: %v", event.EventType(), err)
 	}
 
-	metadata, err := json.Marshal(map[string]interface{}{
-		"version":        event.Version(),
-		"aggregate_type": event.AggregateType(),
-		"aggregate_id":   event.AggregateID(),
-		"timestamp":      event.Timestamp(),
-	})
+	eventData, compression, err := em.compress(eventData)
 
 	if err != nil {
-		return esdb.EventData{}, fmt.Errorf("error when marshalling event %v: %v", event.EventType(), err)
+		return EventData{}, fmt.Errorf("error when compressing event %v: %v", event.EventType(), err)
 	}
 
-	eventID, err := uuid.FromString(event.EventID())
+	// Compressed payloads are stored as binary so stores do not take them for
+	// JSON, the metadata keeps the content type of the serializer.
+	contentType := serializer.ContentType()
+
+	if compression != "" {
+		contentType = BinaryContentType
+	}
+
+	metadata, err := json.Marshal(eventMetadataRecord{
+		Version:       event.Version(),
+		ContentType:   serializer.ContentType(),
+		Compression:   compression,
+		Encrypted:     encrypted,
+		AggregateType: event.AggregateType(),
+		AggregateID:   event.AggregateID(),
+		Timestamp:     event.Timestamp(),
+		CorrelationID: event.CorrelationID(),
+		CausationID:   event.CausationID(),
+		UserID:        event.UserID(),
+		Custom:        event.Metadata(),
+	})
 
 	if err != nil {
-		return esdb.EventData{}, fmt.Errorf("error when marshalling event %v: %v", event.EventType(), err)
+		return EventData{}, fmt.Errorf("error when marshalling event %v: %v", event.EventType(), err)
 	}
 
-	return esdb.EventData{
-		EventID:     eventID,
-		EventType:   event.EventType(),
-		ContentType: esdb.JsonContentType,
+	return EventData{
+		EventID:     event.EventID(),
+		EventType:   eventType,
+		ContentType: contentType,
 		Data:        eventData,
 		Metadata:    metadata,
 	}, nil
 }
 
-func (em *eventMarshaller) FromRecordedEvent(recordedEvent *esdb.RecordedEvent) (Event, error) {
-	eventReflectType, ok := em.eventTypeRegistry[recordedEvent.EventType]
+func (em *eventMarshaller) FromRecordedEvent(ctx context.Context, recordedEvent *RecordedEvent) (Event, error) {
+	// Events stored under an alias are read back under their current name.
+	eventReflectType, eventType, ok := em.eventTypeRegistry.Lookup(recordedEvent.EventType)
 
 	if !ok {
 		return nil, fmt.Errorf("unknown event type %s", recordedEvent.EventType)
 	}
 
-	eventReflect := reflect.New(eventReflectType)
-	eventReflectElm := eventReflect.Elem()
-	metadata := map[string]string{}
+	var metadata eventMetadataRecord
 
-	err := json.Unmarshal(recordedEvent.UserMetadata, &metadata)
+	err := json.Unmarshal(recordedEvent.Metadata, &metadata)
 
 	if err != nil {
 		return nil, fmt.Errorf("error when unmarshalling event %v: %v", recordedEvent.EventType, err)
 	}
 
-	var eventData map[string]interface{}
-	err = json.Unmarshal(recordedEvent.Data, &eventData)
+	// Stores that only tell JSON from binary payloads, like EventStoreDB, keep
+	// the exact content type in the metadata.
+	contentType := metadata.ContentType
 
-	if err != nil {
-		return nil, fmt.Errorf("error when unmarshalling event %v: %v", recordedEvent.EventType, err)
+	if contentType == "" {
+		contentType = recordedEvent.ContentType
 	}
 
-	eventDataBytes, err := json.Marshal(eventData)
+	if contentType == "" {
+		contentType = JsonContentType
+	}
 
-	if err != nil {
-		return nil, err
+	serializer, ok := em.serializers[contentType]
+
+	if !ok {
+		return nil, fmt.Errorf("no serializer registered for content type %s of event %s", contentType, recordedEvent.EventType)
 	}
 
-	err = json.Unmarshal(eventDataBytes, eventReflect.Interface())
+	eventData, err := em.decompress(recordedEvent.Data, metadata.Compression)
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error when decompressing event %v: %v", recordedEvent.EventType, err)
+	}
+
+	if version := currentVersion(eventReflectType); metadata.Version != "" && metadata.Version != version {
+		if contentType != JsonContentType {
+			return nil, fmt.Errorf("cannot upcast event %s stored as %s", recordedEvent.EventType, contentType)
+		}
+
+		eventData, err = em.upcastData(eventType, metadata.Version, version, eventData)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	timestamp, err := time.Parse(time.RFC3339, metadata["timestamp"])
+	eventReflect := reflect.New(eventReflectType)
+
+	err = serializer.Unmarshal(eventData, eventReflect.Interface())
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error when unmarshalling event %v: %v", recordedEvent.EventType, err)
+	}
+
+	if em.encryption != nil && metadata.Encrypted {
+		err = em.encryption.decrypt(ctx, eventReflect, metadata.AggregateID)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	eventBase := NewEventBaseForAggregateWithID(
-		recordedEvent.EventID.String(),
-		AggregateType(metadata["aggregate_type"]),
-		metadata["aggregate_id"],
-		recordedEvent.EventType,
-		timestamp,
+		recordedEvent.EventID,
+		metadata.AggregateType,
+		metadata.AggregateID,
+		eventType,
+		metadata.Timestamp,
 	)
+	eventBase.sequence = int64(recordedEvent.EventNumber)
+	eventBase.metadata = EventMetadata{
+		CorrelationID: metadata.CorrelationID,
+		CausationID:   metadata.CausationID,
+		UserID:        metadata.UserID,
+		Custom:        metadata.Custom,
+	}
 
-	eventReflectElm.FieldByName("EventBase").Set(reflect.ValueOf(eventBase))
-	domainEvent, _ := eventReflectElm.Interface().(Event)
+	eventReflect.Interface().(eventBaseSetter).setEventBase(eventBase)
+	domainEvent := eventReflect.Elem().Interface().(Event)
 
 	return domainEvent, nil
 }
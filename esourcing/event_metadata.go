@@ -0,0 +1,60 @@
+package esourcing
+
+import "context"
+
+// EventMetadata is recorded with every event to trace it back to the request
+// that caused it.
+type EventMetadata struct {
+	// CorrelationID is shared by every event caused by the same request.
+	CorrelationID string
+	// CausationID is the ID of the request or event that directly caused the event.
+	CausationID string
+	// UserID is the actor that issued the request.
+	UserID string
+	// Custom holds arbitrary key/value pairs.
+	Custom map[string]string
+}
+
+type eventMetadataContextKey struct{}
+
+// WithEventMetadata returns a copy of ctx carrying the metadata that
+// AppendEvent records on new events.
+func WithEventMetadata(ctx context.Context, metadata EventMetadata) context.Context {
+	return context.WithValue(ctx, eventMetadataContextKey{}, metadata)
+}
+
+func EventMetadataFromContext(ctx context.Context) EventMetadata {
+	metadata, _ := ctx.Value(eventMetadataContextKey{}).(EventMetadata)
+	return metadata
+}
+
+// ContextFromEvent returns a copy of ctx for handling the event: events
+// appended with it keep the event correlation ID and are caused by the event.
+func ContextFromEvent(ctx context.Context, event Event) context.Context {
+	if event == nil {
+		return ctx
+	}
+
+	return WithEventMetadata(ctx, EventMetadata{
+		CorrelationID: event.CorrelationID(),
+		CausationID:   event.EventID(),
+		UserID:        event.UserID(),
+		Custom:        event.Metadata(),
+	})
+}
+
+// eventMetadataFor fills in the correlation and causation of an event that
+// was not caused by anything traced: it starts a new correlation.
+func eventMetadataFor(ctx context.Context, eventID string) EventMetadata {
+	metadata := EventMetadataFromContext(ctx)
+
+	if metadata.CorrelationID == "" {
+		metadata.CorrelationID = eventID
+	}
+
+	if metadata.CausationID == "" {
+		metadata.CausationID = eventID
+	}
+
+	return metadata
+}
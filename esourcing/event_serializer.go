@@ -0,0 +1,99 @@
+package esourcing
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type jsonSerializer struct{}
+
+// NewJsonSerializer returns the default serializer, which encodes events with
+// encoding/json.
+func NewJsonSerializer() EventSerializer {
+	return jsonSerializer{}
+}
+
+func (jsonSerializer) ContentType() ContentType {
+	return JsonContentType
+}
+
+func (jsonSerializer) Marshal(event Event) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, event interface{}) error {
+	return json.Unmarshal(data, event)
+}
+
+// ProtoMarshaler is implemented by events that encode themselves as protobuf.
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+// ProtoUnmarshaler is implemented by pointers to events that decode themselves
+// from protobuf.
+type ProtoUnmarshaler interface {
+	UnmarshalProto(data []byte) error
+}
+
+type protobufSerializer struct{}
+
+// NewProtobufSerializer returns a serializer for events implementing
+// ProtoMarshaler and ProtoUnmarshaler. The event defines its own message
+// schema, so the serializer only checks and delegates.
+func NewProtobufSerializer() EventSerializer {
+	return protobufSerializer{}
+}
+
+func (protobufSerializer) ContentType() ContentType {
+	return ProtobufContentType
+}
+
+func (protobufSerializer) Marshal(event Event) ([]byte, error) {
+	marshaler, ok := event.(ProtoMarshaler)
+
+	if !ok {
+		return nil, fmt.Errorf("event %s does not implement ProtoMarshaler", event.EventType())
+	}
+
+	return marshaler.MarshalProto()
+}
+
+func (protobufSerializer) Unmarshal(data []byte, event interface{}) error {
+	unmarshaler, ok := event.(ProtoUnmarshaler)
+
+	if !ok {
+		return fmt.Errorf("event %T does not implement ProtoUnmarshaler", event)
+	}
+
+	return unmarshaler.UnmarshalProto(data)
+}
+
+// RegisterSerializer makes the serializer available to UseSerializer and to
+// decode events stored with its content type.
+func (em *eventMarshaller) RegisterSerializer(serializer EventSerializer) {
+	em.serializers[serializer.ContentType()] = serializer
+}
+
+// UseSerializer encodes new events of eventType with the serializer registered
+// for contentType. Events already stored keep their content type, so streams
+// may mix formats.
+func (em *eventMarshaller) UseSerializer(eventType string, contentType ContentType) error {
+	if _, ok := em.serializers[contentType]; !ok {
+		return fmt.Errorf("no serializer registered for content type %s", contentType)
+	}
+
+	em.eventContentTypes[eventType] = contentType
+
+	return nil
+}
+
+func (em *eventMarshaller) serializerFor(eventType string) EventSerializer {
+	contentType, ok := em.eventContentTypes[eventType]
+
+	if !ok {
+		contentType = JsonContentType
+	}
+
+	return em.serializers[contentType]
+}
@@ -0,0 +1,148 @@
+package esourcing
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	eventInterfaceType       = reflect.TypeOf((*Event)(nil)).Elem()
+	eventBaseSetterInterface = reflect.TypeOf((*eventBaseSetter)(nil)).Elem()
+)
+
+// eventNames holds the registered name of every event struct across
+// registries, so AppendEvent stamps events with the same name the store
+// writes. A struct keeps a single name for the whole process.
+var eventNames sync.Map
+
+// RegisteredEventType describes an event struct known to a registry.
+type RegisteredEventType struct {
+	Name    string
+	Aliases []string
+	Type    reflect.Type
+}
+
+// EventTypeRegistry maps the stable names events are stored under to their
+// Go structs. Names are chosen on registration and are independent of the
+// struct name or package, and legacy names can be kept as aliases.
+type EventTypeRegistry struct {
+	mu      sync.RWMutex
+	types   map[string]reflect.Type
+	names   map[reflect.Type]string
+	aliases map[reflect.Type][]string
+}
+
+func NewEventTypeRegistry() *EventTypeRegistry {
+	return &EventTypeRegistry{
+		types:   map[string]reflect.Type{},
+		names:   map[reflect.Type]string{},
+		aliases: map[reflect.Type][]string{},
+	}
+}
+
+// Register adds the event struct pointed to by eventType, e.g.
+// (*ShoppingCartCreated)(nil), under name. Events stored under any of the
+// aliases are decoded into the same struct and read back under name. It fails
+// when the struct does not implement Event or does not embed EventBase, or
+// when the name or an alias already belongs to another struct.
+func (r *EventTypeRegistry) Register(eventType EventType, name string, aliases ...string) error {
+	t := reflect.TypeOf(eventType).Elem()
+
+	if !t.Implements(eventInterfaceType) || !reflect.PointerTo(t).Implements(eventBaseSetterInterface) {
+		return fmt.Errorf("event type %s must implement esourcing.Event and embed esourcing.EventBase", t)
+	}
+
+	if name == "" {
+		return fmt.Errorf("event type %s must be registered with a name", t)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if registered, ok := r.names[t]; ok && registered != name {
+		return fmt.Errorf("event type %s is already registered as %s", t, registered)
+	}
+
+	for _, alias := range append([]string{name}, aliases...) {
+		if other, ok := r.types[alias]; ok && other != t {
+			return fmt.Errorf("event name %s of %s is already registered for %s", alias, t, other)
+		}
+	}
+
+	if registered, loaded := eventNames.LoadOrStore(t, name); loaded && registered != name {
+		return fmt.Errorf("event type %s is already registered as %s", t, registered)
+	}
+
+	r.names[t] = name
+	r.types[name] = t
+
+	for _, alias := range aliases {
+		if _, ok := r.types[alias]; !ok {
+			r.types[alias] = t
+			r.aliases[t] = append(r.aliases[t], alias)
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the struct and the current name of the event stored under
+// name, which may be an alias.
+func (r *EventTypeRegistry) Lookup(name string) (reflect.Type, string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.types[name]
+
+	if !ok {
+		return nil, "", false
+	}
+
+	return t, r.names[t], true
+}
+
+// NameOf returns the name the event struct t is registered under.
+func (r *EventTypeRegistry) NameOf(t reflect.Type) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, ok := r.names[t]
+
+	return name, ok
+}
+
+// RegisteredTypes lists the registered event types sorted by name.
+func (r *EventTypeRegistry) RegisteredTypes() []RegisteredEventType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	registered := make([]RegisteredEventType, 0, len(r.names))
+
+	for t, name := range r.names {
+		registered = append(registered, RegisteredEventType{
+			Name:    name,
+			Aliases: append([]string(nil), r.aliases[t]...),
+			Type:    t,
+		})
+	}
+
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].Name < registered[j].Name
+	})
+
+	return registered
+}
+
+// eventTypeName returns the registered name of E, or its struct name when E
+// was never registered.
+func eventTypeName[E Event]() string {
+	t := reflect.TypeFor[E]()
+
+	if name, ok := eventNames.Load(t); ok {
+		return name.(string)
+	}
+
+	return t.Name()
+}
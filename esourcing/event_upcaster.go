@@ -0,0 +1,137 @@
+package esourcing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+func (em *eventMarshaller) RegisterUpcaster(upcaster EventUpcaster) error {
+	if upcaster.From == upcaster.To {
+		return fmt.Errorf("upcaster of event %s must change the version, got %s to %s", upcaster.EventType, upcaster.From, upcaster.To)
+	}
+
+	if _, ok := em.upcasters[upcaster.EventType]; !ok {
+		em.upcasters[upcaster.EventType] = map[string]EventUpcaster{}
+	}
+
+	if _, ok := em.upcasters[upcaster.EventType][upcaster.From]; ok {
+		return fmt.Errorf("upcaster of event %s from version %s already registered", upcaster.EventType, upcaster.From)
+	}
+
+	em.upcasters[upcaster.EventType][upcaster.From] = upcaster
+
+	return nil
+}
+
+// ValidateUpcasters checks that upcasters only target registered event types
+// and that every version they upcast from reaches the current Version() of
+// the event without loops.
+func (em *eventMarshaller) ValidateUpcasters() error {
+	var errs []error
+
+	for eventType, upcasters := range em.upcasters {
+		eventReflectType, name, ok := em.eventTypeRegistry.Lookup(eventType)
+
+		if ok && name != eventType {
+			errs = append(errs, fmt.Errorf("upcasters of event %s must be registered under its name %s", eventType, name))
+			continue
+		}
+
+		if !ok {
+			errs = append(errs, fmt.Errorf("upcasters registered for unknown event type %s", eventType))
+			continue
+		}
+
+		current := currentVersion(eventReflectType)
+
+		for from := range upcasters {
+			if _, err := em.upcastPath(eventType, from, current); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// upcast applies the upcaster chain of the event type to data stored at
+// version until it reaches the current version.
+func (em *eventMarshaller) upcast(eventType string, version string, current string, data map[string]interface{}) (map[string]interface{}, error) {
+	if version == "" || version == current {
+		return data, nil
+	}
+
+	path, err := em.upcastPath(eventType, version, current)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, upcaster := range path {
+		data = upcaster.Upcast(data)
+	}
+
+	return data, nil
+}
+
+func (em *eventMarshaller) upcastPath(eventType string, from string, to string) ([]EventUpcaster, error) {
+	var path []EventUpcaster
+	visited := map[string]bool{}
+
+	for version := from; version != to; {
+		if visited[version] {
+			return nil, fmt.Errorf("upcasters of event %s loop at version %s", eventType, version)
+		}
+
+		visited[version] = true
+
+		upcaster, ok := em.upcasters[eventType][version]
+
+		if !ok {
+			return nil, fmt.Errorf("no upcaster of event %s from version %s to reach version %s", eventType, version, to)
+		}
+
+		path = append(path, upcaster)
+		version = upcaster.To
+	}
+
+	return path, nil
+}
+
+func currentVersion(eventReflectType reflect.Type) string {
+	event, ok := reflect.New(eventReflectType).Elem().Interface().(Event)
+
+	if !ok {
+		return ""
+	}
+
+	return event.Version()
+}
+
+// upcastData runs the upcasters of eventType over the JSON payload stored at
+// version, returning the payload of the current version.
+func (em *eventMarshaller) upcastData(eventType string, version string, current string, data []byte) ([]byte, error) {
+	var fields map[string]interface{}
+
+	err := json.Unmarshal(data, &fields)
+
+	if err != nil {
+		return nil, fmt.Errorf("error when unmarshalling event %v: %v", eventType, err)
+	}
+
+	fields, err = em.upcast(eventType, version, current, fields)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(fields)
+
+	if err != nil {
+		return nil, fmt.Errorf("error when marshalling upcasted event %v: %v", eventType, err)
+	}
+
+	return data, nil
+}
@@ -2,15 +2,19 @@ package esourcing
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"reflect"
+	"io"
 
 	"github.com/EventStore/EventStore-Client-Go/esdb"
+	"github.com/gofrs/uuid"
 )
 
+var ErrConcurrencyConflict = fmt.Errorf("concurrency conflict")
+
 type eventStore struct {
 	client            *esdb.Client
-	eventTypeRegistry EventTypeRegistry
+	eventTypeRegistry *EventTypeRegistry
 	eventMarshaller   EventMarshaller
 }
 
@@ -20,6 +24,7 @@ type EventStoreConfig struct {
 	Password string
 }
 
+// NewEventStore returns an EventStore backed by EventStoreDB.
 func NewEventStore(params EventStoreConfig) (EventStore, error) {
 	connectionString := fmt.Sprintf("esdb://%s:%s@%s?tls=false&tlsverifycert=false", params.Username, params.Password, params.Host)
 	config, err := esdb.ParseConnectionString(connectionString)
@@ -34,7 +39,7 @@ func NewEventStore(params EventStoreConfig) (EventStore, error) {
 		return nil, fmt.Errorf("error connection to eventstoredb: %s", err)
 	}
 
-	eventTypeRegistry := make(EventTypeRegistry)
+	eventTypeRegistry := NewEventTypeRegistry()
 
 	return &eventStore{
 		client:            client,
@@ -43,26 +48,53 @@ func NewEventStore(params EventStoreConfig) (EventStore, error) {
 	}, nil
 }
 
-func (es *eventStore) RegisterEventType(eventType EventType) {
-	t := reflect.TypeOf(eventType).Elem()
-	es.eventTypeRegistry[t.Name()] = t
+func (es *eventStore) RegisterEventType(eventType EventType, name string, aliases ...string) error {
+	return es.eventTypeRegistry.Register(eventType, name, aliases...)
+}
+
+func (es *eventStore) RegisteredEventTypes() []RegisteredEventType {
+	return es.eventTypeRegistry.RegisteredTypes()
 }
 
-func (es *eventStore) ReadStream(ctx context.Context, streamID string, options esdb.ReadStreamOptions, count uint64) (events []Event, err error) {
-	readStream, err := es.client.ReadStream(ctx, streamID, options, count)
+func (es *eventStore) ReadStream(ctx context.Context, streamID string, options ReadStreamOptions, count uint64) (events []Event, err error) {
+	readStream, err := es.client.ReadStream(ctx, streamID, esdb.ReadStreamOptions{
+		Direction: toEsdbDirection(options.Direction),
+		From:      toEsdbStreamPosition(options.From),
+	}, count)
+
+	if errors.Is(err, esdb.ErrStreamNotFound) {
+		return events, ErrStreamNotFound
+	}
+
+	var streamDeletedError *esdb.StreamDeletedError
+
+	if errors.As(err, &streamDeletedError) {
+		return events, &StreamDeletedError{StreamID: streamID}
+	}
+
+	// The client reports a read past the end of the stream as io.EOF.
+	if errors.Is(err, io.EOF) {
+		return events, nil
+	}
 
 	if err != nil {
-		return events, err
+		return events, fmt.Errorf("error when reading stream %s: %w", streamID, err)
 	}
 
+	defer readStream.Close()
+
 	for {
-		evt, _ := readStream.Recv()
+		evt, err := readStream.Recv()
 
-		if evt == nil {
-			return events, err
+		if errors.Is(err, io.EOF) {
+			return events, nil
 		}
 
-		event, err := es.eventMarshaller.FromRecordedEvent(evt.Event)
+		if err != nil {
+			return events, fmt.Errorf("error when reading stream %s: %w", streamID, err)
+		}
+
+		event, err := es.eventMarshaller.FromRecordedEvent(ctx, fromEsdbRecordedEvent(evt.OriginalEvent()))
 
 		if err != nil {
 			return events, err
@@ -73,13 +105,13 @@ func (es *eventStore) ReadStream(ctx context.Context, streamID string, options e
 }
 
 func (es *eventStore) ReadLastEventFromStream(context context.Context, streamID string) (Event, error) {
-	events, err := es.ReadStream(context, streamID, esdb.ReadStreamOptions{
-		From:      esdb.End{},
-		Direction: esdb.Backwards,
+	events, err := es.ReadStream(context, streamID, ReadStreamOptions{
+		From:      End{},
+		Direction: Backwards,
 	}, 1)
 
 	if err != nil {
-		return nil, fmt.Errorf("error when reading stream %s: %v", streamID, err)
+		return nil, fmt.Errorf("error when reading stream %s: %w", streamID, err)
 	}
 
 	if len(events) > 0 {
@@ -89,49 +121,297 @@ func (es *eventStore) ReadLastEventFromStream(context context.Context, streamID
 	return nil, nil
 }
 
-func (es *eventStore) AppendToStream(ctx context.Context, streamID string, events []Event) (*esdb.WriteResult, error) {
+func (es *eventStore) ReadAll(ctx context.Context, options ReadAllOptions, count uint64) ([]ResolvedEvent, error) {
+	return readAll(ctx, es.eventMarshaller, options, count, es.readAllBatch)
+}
+
+// readAllBatch reads one more event than asked, as EventStoreDB includes the
+// event at the starting position which ReadAll excludes.
+func (es *eventStore) readAllBatch(ctx context.Context, direction Direction, from AllPosition, batchSize uint64) ([]*RecordedEvent, bool, error) {
+	readStream, err := es.client.ReadAll(ctx, esdb.ReadAllOptions{
+		Direction: toEsdbDirection(direction),
+		From:      toEsdbAllPosition(from),
+	}, batchSize+1)
+
+	if errors.Is(err, io.EOF) {
+		return nil, true, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error when reading all events: %w", err)
+	}
+
+	defer readStream.Close()
+
+	var recordedEvents []*RecordedEvent
+	var read uint64
+
+	for {
+		evt, err := readStream.Recv()
+
+		if errors.Is(err, io.EOF) {
+			return recordedEvents, read < batchSize+1, nil
+		}
+
+		if err != nil {
+			return nil, false, fmt.Errorf("error when reading all events: %w", err)
+		}
+
+		read++
+		recordedEvent := fromEsdbRecordedEvent(evt.OriginalEvent())
+
+		if position, ok := from.(Position); ok && recordedEvent.Position == position {
+			continue
+		}
+
+		if uint64(len(recordedEvents)) < batchSize {
+			recordedEvents = append(recordedEvents, recordedEvent)
+		}
+	}
+}
+
+func (es *eventStore) AppendToStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision, events []Event) (*WriteResult, error) {
 	proposedEvents := make([]esdb.EventData, len(events))
 
 	for i, event := range events {
-		eventData, err := es.eventMarshaller.ToEventData(event)
+		eventData, err := es.eventMarshaller.ToEventData(ctx, event)
+
+		if err != nil {
+			return nil, err
+		}
+
+		proposedEvents[i], err = toEsdbEventData(eventData)
 
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	result, err := es.client.AppendToStream(ctx, streamID, esdb.AppendToStreamOptions{ExpectedRevision: toEsdbExpectedRevision(expectedRevision)}, proposedEvents...)
 
-		proposedEvents[i] = eventData
+	if errors.Is(err, esdb.ErrWrongExpectedStreamRevision) {
+		return nil, fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
 	}
 
-	result, err := es.client.AppendToStream(ctx, streamID, esdb.AppendToStreamOptions{ExpectedRevision: esdb.Any{}}, proposedEvents...)
+	var streamDeletedError *esdb.StreamDeletedError
+
+	if errors.As(err, &streamDeletedError) {
+		return nil, &StreamDeletedError{StreamID: streamID}
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("error when appending to stream %s: %v", streamID, err)
 	}
 
-	return result, nil
+	return &WriteResult{
+		Position:             Position{Commit: result.CommitPosition, Prepare: result.PreparePosition},
+		NextExpectedRevision: result.NextExpectedVersion,
+	}, nil
 }
 
-func (es *eventStore) SubscribeToAll(ctx context.Context, options esdb.SubscribeToAllOptions) (*esdb.Subscription, error) {
-	return es.client.SubscribeToAll(ctx, options)
+func (es *eventStore) SubscribeToAll(ctx context.Context, options SubscribeToAllOptions) (Subscription, error) {
+	esdbOptions := esdb.SubscribeToAllOptions{
+		From: toEsdbAllPosition(options.From),
+	}
+
+	if options.Filter != nil {
+		filterType := esdb.EventFilterType
+
+		if options.Filter.Type == StreamFilterType {
+			filterType = esdb.StreamFilterType
+		}
+
+		esdbOptions.Filter = &esdb.SubscriptionFilter{
+			Type:     filterType,
+			Prefixes: options.Filter.Prefixes,
+			Regex:    options.Filter.Regex,
+		}
+	}
+
+	subscription, err := es.client.SubscribeToAll(ctx, esdbOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &esdbSubscription{subscription}, nil
 }
 
-func (es *eventStore) CreatePersistentSubscription(ctx context.Context, streamName string, groupName string, options esdb.PersistentStreamSubscriptionOptions) error {
-	return es.client.CreatePersistentSubscription(ctx, streamName, groupName, options)
+func (es *eventStore) CreatePersistentSubscription(ctx context.Context, streamName string, groupName string, options PersistentSubscriptionOptions) error {
+	return es.client.CreatePersistentSubscription(ctx, streamName, groupName, esdb.PersistentStreamSubscriptionOptions{
+		From: toEsdbStreamPosition(options.From),
+	})
 }
 
-func (es *eventStore) PersistentSubscribeToStream(ctx context.Context, streamName string, groupName string, options esdb.ConnectToPersistentSubscriptionOptions) (*esdb.PersistentSubscription, error) {
-	return es.client.ConnectToPersistentSubscription(ctx, streamName, groupName, options)
+func (es *eventStore) PersistentSubscribeToStream(ctx context.Context, streamName string, groupName string) (Subscription, error) {
+	subscription, err := es.client.ConnectToPersistentSubscription(ctx, streamName, groupName, esdb.ConnectToPersistentSubscriptionOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &esdbSubscription{subscription}, nil
+}
+
+func (r *eventStore) SubscribeToStream(ctx context.Context, streamID string, options SubscribeToStreamOptions) (Subscription, error) {
+	subscription, err := r.client.SubscribeToStream(ctx, streamID, esdb.SubscribeToStreamOptions{
+		From: toEsdbStreamPosition(options.From),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &esdbSubscription{subscription}, nil
+}
+
+func (r *eventStore) DeleteStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error {
+	_, err := r.client.DeleteStream(ctx, streamID, esdb.DeleteStreamOptions{ExpectedRevision: toEsdbExpectedRevision(expectedRevision)})
+
+	return fromEsdbDeleteError(streamID, err)
 }
 
-func (r *eventStore) SubscribeToStream(ctx context.Context, streamID string, options esdb.SubscribeToStreamOptions) (*esdb.Subscription, error) {
-	return r.client.SubscribeToStream(ctx, streamID, options)
+func (r *eventStore) TombstoneStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error {
+	_, err := r.client.TombstoneStream(ctx, streamID, esdb.TombstoneStreamOptions{ExpectedRevision: toEsdbExpectedRevision(expectedRevision)})
+
+	return fromEsdbDeleteError(streamID, err)
 }
 
-func (r *eventStore) DeleteStream(ctx context.Context, streamID string) error {
-	_, err := r.client.DeleteStream(ctx, streamID, esdb.DeleteStreamOptions{ExpectedRevision: esdb.Any{}})
-	return err
+func fromEsdbDeleteError(streamID string, err error) error {
+	var streamDeletedError *esdb.StreamDeletedError
+
+	if errors.As(err, &streamDeletedError) {
+		return &StreamDeletedError{StreamID: streamID}
+	}
+
+	if errors.Is(err, esdb.ErrWrongExpectedStreamRevision) {
+		return fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error when deleting stream %s: %w", streamID, err)
+	}
+
+	return nil
 }
 
 func (r *eventStore) GetMarshaller() EventMarshaller {
 	return r.eventMarshaller
 }
+
+// esdbSubscription adapts both catch-up and persistent EventStoreDB
+// subscriptions to the store-neutral Subscription interface.
+type esdbSubscription struct {
+	inner interface {
+		Recv() *esdb.SubscriptionEvent
+		Close() error
+	}
+}
+
+func (s *esdbSubscription) Recv() *SubscriptionEvent {
+	evt := s.inner.Recv()
+	subscriptionEvent := &SubscriptionEvent{}
+
+	if evt.EventAppeared != nil {
+		subscriptionEvent.EventAppeared = fromEsdbRecordedEvent(evt.EventAppeared.OriginalEvent())
+	}
+
+	if evt.CheckPointReached != nil {
+		subscriptionEvent.CheckpointReached = &Position{
+			Commit:  evt.CheckPointReached.Commit,
+			Prepare: evt.CheckPointReached.Prepare,
+		}
+	}
+
+	if evt.SubscriptionDropped != nil {
+		subscriptionEvent.SubscriptionDropped = &SubscriptionDropped{Error: evt.SubscriptionDropped.Error}
+	}
+
+	return subscriptionEvent
+}
+
+func (s *esdbSubscription) Close() error {
+	return s.inner.Close()
+}
+
+func toEsdbDirection(direction Direction) esdb.Direction {
+	if direction == Backwards {
+		return esdb.Backwards
+	}
+
+	return esdb.Forwards
+}
+
+func toEsdbStreamPosition(position StreamPosition) esdb.StreamPosition {
+	switch p := position.(type) {
+	case End:
+		return esdb.End{}
+	case StreamRevision:
+		return esdb.Revision(p.Value)
+	}
+
+	return esdb.Start{}
+}
+
+func toEsdbAllPosition(position AllPosition) esdb.AllPosition {
+	switch p := position.(type) {
+	case End:
+		return esdb.End{}
+	case Position:
+		return esdb.Position{Commit: p.Commit, Prepare: p.Prepare}
+	}
+
+	return esdb.Start{}
+}
+
+func toEsdbExpectedRevision(expectedRevision ExpectedRevision) esdb.ExpectedRevision {
+	switch r := expectedRevision.(type) {
+	case NoStream:
+		return esdb.NoStream{}
+	case StreamExists:
+		return esdb.StreamExists{}
+	case StreamRevision:
+		return esdb.Revision(r.Value)
+	}
+
+	return esdb.Any{}
+}
+
+func toEsdbEventData(eventData EventData) (esdb.EventData, error) {
+	eventID, err := uuid.FromString(eventData.EventID)
+
+	if err != nil {
+		return esdb.EventData{}, fmt.Errorf("error when marshalling event %v: %v", eventData.EventType, err)
+	}
+
+	contentType := esdb.BinaryContentType
+
+	if eventData.ContentType == JsonContentType {
+		contentType = esdb.JsonContentType
+	}
+
+	return esdb.EventData{
+		EventID:     eventID,
+		EventType:   eventData.EventType,
+		ContentType: contentType,
+		Data:        eventData.Data,
+		Metadata:    eventData.Metadata,
+	}, nil
+}
+
+func fromEsdbRecordedEvent(recordedEvent *esdb.RecordedEvent) *RecordedEvent {
+	return &RecordedEvent{
+		EventID:     recordedEvent.EventID.String(),
+		EventType:   recordedEvent.EventType,
+		ContentType: ContentType(recordedEvent.ContentType),
+		StreamID:    recordedEvent.StreamID,
+		EventNumber: recordedEvent.EventNumber,
+		Position: Position{
+			Commit:  recordedEvent.Position.Commit,
+			Prepare: recordedEvent.Position.Prepare,
+		},
+		CreatedDate: recordedEvent.CreatedDate,
+		Data:        recordedEvent.Data,
+		Metadata:    recordedEvent.UserMetadata,
+	}
+}
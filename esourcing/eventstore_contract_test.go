@@ -0,0 +1,234 @@
+package esourcing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testEventStoreContract runs the behavior every EventStore implementation
+// shares against the stores returned by newStore, one per test.
+func testEventStoreContract(t *testing.T, newStore func(t *testing.T) EventStore) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) EventStore {
+		store := newStore(t)
+		registerCounterEvents(t, store)
+
+		return store
+	}
+
+	t.Run("appends with expected revision", func(t *testing.T) {
+		store := setup(t)
+
+		result, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.NextExpectedRevision != 1 {
+			t.Fatalf("expected next revision 1, got %d", result.NextExpectedRevision)
+		}
+
+		result, err = store.AppendToStream(ctx, "counter#1", Revision(1), incrementEvents("1", 3))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.NextExpectedRevision != 2 {
+			t.Fatalf("expected next revision 2, got %d", result.NextExpectedRevision)
+		}
+
+		if _, err := store.AppendToStream(ctx, "counter#1", StreamExists{}, incrementEvents("1", 4)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.AppendToStream(ctx, "counter#1", Any{}, incrementEvents("1", 5)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rejects conflicting appends", func(t *testing.T) {
+		store := setup(t)
+
+		if _, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 1, 2)); err != nil {
+			t.Fatal(err)
+		}
+
+		conflicts := map[string]ExpectedRevision{
+			"no stream":       NoStream{},
+			"stale revision":  Revision(0),
+			"future revision": Revision(5),
+		}
+
+		for name, expectedRevision := range conflicts {
+			_, err := store.AppendToStream(ctx, "counter#1", expectedRevision, incrementEvents("1", 3))
+
+			if !errors.Is(err, ErrConcurrencyConflict) {
+				t.Errorf("%s: expected a concurrency conflict, got %v", name, err)
+			}
+		}
+
+		_, err := store.AppendToStream(ctx, "counter#2", StreamExists{}, incrementEvents("2", 1))
+
+		if !errors.Is(err, ErrConcurrencyConflict) {
+			t.Errorf("stream exists: expected a concurrency conflict, got %v", err)
+		}
+
+		events, err := store.ReadStream(ctx, "counter#1", ReadStreamOptions{From: Start{}}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(events) != 2 {
+			t.Fatalf("expected the rejected appends to leave 2 events, got %d", len(events))
+		}
+	})
+
+	t.Run("reads streams", func(t *testing.T) {
+		store := setup(t)
+
+		if _, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 1, 2, 3, 4)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.AppendToStream(ctx, "counter#2", NoStream{}, incrementEvents("2", 10)); err != nil {
+			t.Fatal(err)
+		}
+
+		reads := []struct {
+			name    string
+			options ReadStreamOptions
+			count   uint64
+			want    []int
+		}{
+			{"forwards", ReadStreamOptions{From: Start{}}, 10, []int{1, 2, 3, 4}},
+			{"forwards from revision", ReadStreamOptions{From: Revision(2)}, 10, []int{3, 4}},
+			{"forwards with count", ReadStreamOptions{From: Start{}}, 2, []int{1, 2}},
+			{"backwards", ReadStreamOptions{From: End{}, Direction: Backwards}, 10, []int{4, 3, 2, 1}},
+			{"backwards from revision", ReadStreamOptions{From: Revision(1), Direction: Backwards}, 10, []int{2, 1}},
+		}
+
+		for _, read := range reads {
+			events, err := store.ReadStream(ctx, "counter#1", read.options, read.count)
+			if err != nil {
+				t.Fatalf("%s: %v", read.name, err)
+			}
+
+			if len(events) != len(read.want) {
+				t.Fatalf("%s: expected %d events, got %d", read.name, len(read.want), len(events))
+			}
+
+			for i, event := range events {
+				incremented, ok := event.(counterIncremented)
+
+				if !ok || incremented.By != read.want[i] {
+					t.Fatalf("%s: expected increment by %d at %d, got %#v", read.name, read.want[i], i, event)
+				}
+
+				if incremented.SequenceNumber() != int64(incremented.By-1) {
+					t.Errorf("%s: expected sequence number %d, got %d", read.name, incremented.By-1, incremented.SequenceNumber())
+				}
+
+				if incremented.AggregateID() != "1" || incremented.AggregateType() != counterAggregateType {
+					t.Errorf("%s: unexpected aggregate %s %s", read.name, incremented.AggregateType(), incremented.AggregateID())
+				}
+			}
+		}
+
+		last, err := store.ReadLastEventFromStream(ctx, "counter#1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if last.(counterIncremented).By != 4 {
+			t.Errorf("expected the last event to increment by 4, got %#v", last)
+		}
+
+		_, err = store.ReadStream(ctx, "counter#3", ReadStreamOptions{From: Start{}}, 10)
+
+		if !errors.Is(err, ErrStreamNotFound) {
+			t.Errorf("expected stream not found, got %v", err)
+		}
+	})
+
+	t.Run("subscribes to all", func(t *testing.T) {
+		store := setup(t)
+
+		if _, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 1, 2)); err != nil {
+			t.Fatal(err)
+		}
+
+		subscriptionCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		subscription, err := store.SubscribeToAll(subscriptionCtx, SubscribeToAllOptions{From: Start{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer subscription.Close()
+
+		first := recvEvent(t, subscription)
+		second := recvEvent(t, subscription)
+
+		if _, err := store.AppendToStream(ctx, "counter#2", NoStream{}, incrementEvents("2", 3)); err != nil {
+			t.Fatal(err)
+		}
+
+		third := recvEvent(t, subscription)
+
+		if first.StreamID != "counter#1" || first.EventNumber != 0 || second.EventNumber != 1 || third.StreamID != "counter#2" {
+			t.Fatalf("unexpected events %s@%d, %s@%d, %s@%d", first.StreamID, first.EventNumber, second.StreamID, second.EventNumber, third.StreamID, third.EventNumber)
+		}
+
+		if !(first.Position.Commit < second.Position.Commit && second.Position.Commit < third.Position.Commit) {
+			t.Errorf("expected increasing positions, got %d, %d, %d", first.Position.Commit, second.Position.Commit, third.Position.Commit)
+		}
+
+		resumed, err := store.SubscribeToAll(subscriptionCtx, SubscribeToAllOptions{From: first.Position})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer resumed.Close()
+
+		if next := recvEvent(t, resumed); next.EventID != second.EventID {
+			t.Errorf("expected a subscription from a position to resume after it, got %s@%d", next.StreamID, next.EventNumber)
+		}
+	})
+
+	t.Run("subscribes to a stream", func(t *testing.T) {
+		store := setup(t)
+
+		if _, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 1)); err != nil {
+			t.Fatal(err)
+		}
+
+		subscriptionCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		subscription, err := store.SubscribeToStream(subscriptionCtx, "counter#1", SubscribeToStreamOptions{From: Start{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer subscription.Close()
+
+		if first := recvEvent(t, subscription); first.EventNumber != 0 {
+			t.Fatalf("expected revision 0, got %d", first.EventNumber)
+		}
+
+		if _, err := store.AppendToStream(ctx, "counter#2", NoStream{}, incrementEvents("2", 2)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.AppendToStream(ctx, "counter#1", Revision(0), incrementEvents("1", 3)); err != nil {
+			t.Fatal(err)
+		}
+
+		if next := recvEvent(t, subscription); next.StreamID != "counter#1" || next.EventNumber != 1 {
+			t.Fatalf("expected counter#1@1, got %s@%d", next.StreamID, next.EventNumber)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package esourcing
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const counterAggregateType = AggregateType("counter")
+
+type counterIncremented struct {
+	EventBase
+	By int `json:"by"`
+}
+
+func (e counterIncremented) Version() string {
+	return "v1"
+}
+
+// counter is the aggregate the tests of the package persist.
+type counter struct {
+	*AggregateRoot
+	value int
+}
+
+func newCounter(id string) *counter {
+	c := &counter{
+		AggregateRoot: NewAggregateRoot(counterAggregateType, id),
+	}
+
+	On(c, func(e counterIncremented) {
+		c.value += e.By
+	})
+
+	return c
+}
+
+func (c *counter) Increment(ctx context.Context, by int) {
+	AppendEvent(ctx, c, counterIncremented{By: by})
+}
+
+func (c *counter) Snapshot() ([]byte, error) {
+	return json.Marshal(c.value)
+}
+
+func (c *counter) RestoreSnapshot(state []byte) error {
+	return json.Unmarshal(state, &c.value)
+}
+
+func registerCounterEvents(t testing.TB, store EventStore) {
+	t.Helper()
+
+	if err := store.RegisterEventType((*counterIncremented)(nil), "CounterIncremented"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// incrementEvents returns the events of a new counter incremented by each of
+// the given values.
+func incrementEvents(id string, by ...int) []Event {
+	c := newCounter(id)
+
+	for _, value := range by {
+		c.Increment(context.Background(), value)
+	}
+
+	return c.UncommittedEvents()
+}
+
+// recvEvent waits for the next event delivered by the subscription, skipping
+// checkpoints.
+func recvEvent(t *testing.T, subscription Subscription) *RecordedEvent {
+	t.Helper()
+
+	received := make(chan *SubscriptionEvent, 1)
+
+	for {
+		go func() {
+			received <- subscription.Recv()
+		}()
+
+		select {
+		case evt := <-received:
+			if evt.SubscriptionDropped != nil {
+				t.Fatalf("subscription dropped: %v", evt.SubscriptionDropped.Error)
+			}
+
+			if evt.EventAppeared != nil {
+				return evt.EventAppeared
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package esourcing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type inMemoryStream struct {
+	events     []*RecordedEvent
+	revision   int64
+	tombstoned bool
+}
+
+type inMemoryEventStore struct {
+	mu                sync.RWMutex
+	streams           map[string]*inMemoryStream
+	log               []*RecordedEvent
+	appended          chan struct{}
+	eventTypeRegistry *EventTypeRegistry
+	eventMarshaller   EventMarshaller
+}
+
+// NewInMemoryEventStore returns a goroutine-safe EventStore that keeps every
+// event in process memory. Events go through the same marshaller as the
+// EventStoreDB implementation, so it can stand in for it in tests and local runs.
+func NewInMemoryEventStore() EventStore {
+	eventTypeRegistry := NewEventTypeRegistry()
+
+	return &inMemoryEventStore{
+		streams:           map[string]*inMemoryStream{},
+		appended:          make(chan struct{}),
+		eventTypeRegistry: eventTypeRegistry,
+		eventMarshaller:   NewEventMarshaller(eventTypeRegistry),
+	}
+}
+
+func (s *inMemoryEventStore) RegisterEventType(eventType EventType, name string, aliases ...string) error {
+	return s.eventTypeRegistry.Register(eventType, name, aliases...)
+}
+
+func (s *inMemoryEventStore) RegisteredEventTypes() []RegisteredEventType {
+	return s.eventTypeRegistry.RegisteredTypes()
+}
+
+func (s *inMemoryEventStore) ReadStream(ctx context.Context, streamID string, options ReadStreamOptions, count uint64) (events []Event, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stream, ok := s.streams[streamID]
+
+	if ok && stream.tombstoned {
+		return events, &StreamDeletedError{StreamID: streamID}
+	}
+
+	if !ok || len(stream.events) == 0 {
+		return events, ErrStreamNotFound
+	}
+
+	for _, recordedEvent := range stream.slice(options) {
+		if uint64(len(events)) >= count {
+			break
+		}
+
+		event, err := s.eventMarshaller.FromRecordedEvent(ctx, recordedEvent)
+
+		if err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (s *inMemoryEventStore) ReadLastEventFromStream(ctx context.Context, streamID string) (Event, error) {
+	events, err := s.ReadStream(ctx, streamID, ReadStreamOptions{
+		From:      End{},
+		Direction: Backwards,
+	}, 1)
+
+	if err != nil {
+		return nil, fmt.Errorf("error when reading stream %s: %w", streamID, err)
+	}
+
+	if len(events) > 0 {
+		return events[0], nil
+	}
+
+	return nil, nil
+}
+
+func (s *inMemoryEventStore) ReadAll(ctx context.Context, options ReadAllOptions, count uint64) ([]ResolvedEvent, error) {
+	return readAll(ctx, s.eventMarshaller, options, count, s.readAllBatch)
+}
+
+// readAllBatch reads the log, where the event at index i has position i+1.
+func (s *inMemoryEventStore) readAllBatch(ctx context.Context, direction Direction, from AllPosition, batchSize uint64) ([]*RecordedEvent, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var recordedEvents []*RecordedEvent
+
+	if direction == Backwards {
+		next := len(s.log) - 1
+
+		switch from := from.(type) {
+		case Start:
+			next = -1
+		case Position:
+			next = int(from.Commit) - 2
+		}
+
+		for ; next >= 0 && uint64(len(recordedEvents)) < batchSize; next-- {
+			recordedEvents = append(recordedEvents, s.log[next])
+		}
+
+		return recordedEvents, next < 0, nil
+	}
+
+	next := 0
+
+	switch from := from.(type) {
+	case End:
+		next = len(s.log)
+	case Position:
+		next = int(from.Commit)
+	}
+
+	for ; next < len(s.log) && uint64(len(recordedEvents)) < batchSize; next++ {
+		recordedEvents = append(recordedEvents, s.log[next])
+	}
+
+	return recordedEvents, next >= len(s.log), nil
+}
+
+func (s *inMemoryEventStore) AppendToStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision, events []Event) (*WriteResult, error) {
+	proposedEvents := make([]EventData, len(events))
+
+	for i, event := range events {
+		eventData, err := s.eventMarshaller.ToEventData(ctx, event)
+
+		if err != nil {
+			return nil, err
+		}
+
+		proposedEvents[i] = eventData
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stream, ok := s.streams[streamID]
+
+	if !ok {
+		stream = &inMemoryStream{revision: NoStreamRevision}
+	}
+
+	if stream.tombstoned {
+		return nil, &StreamDeletedError{StreamID: streamID}
+	}
+
+	if !acceptsExpectedRevision(expectedRevision, stream.revision, ok && len(stream.events) > 0) {
+		return nil, fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
+	}
+
+	s.streams[streamID] = stream
+	now := time.Now().UTC()
+
+	for _, eventData := range proposedEvents {
+		stream.revision++
+		position := uint64(len(s.log) + 1)
+
+		recordedEvent := &RecordedEvent{
+			EventID:     eventData.EventID,
+			EventType:   eventData.EventType,
+			ContentType: eventData.ContentType,
+			StreamID:    streamID,
+			EventNumber: uint64(stream.revision),
+			Position:    Position{Commit: position, Prepare: position},
+			CreatedDate: now,
+			Data:        eventData.Data,
+			Metadata:    eventData.Metadata,
+		}
+
+		stream.events = append(stream.events, recordedEvent)
+		s.log = append(s.log, recordedEvent)
+	}
+
+	close(s.appended)
+	s.appended = make(chan struct{})
+
+	position := uint64(len(s.log))
+
+	return &WriteResult{
+		Position:             Position{Commit: position, Prepare: position},
+		NextExpectedRevision: uint64(stream.revision),
+	}, nil
+}
+
+func (s *inMemoryEventStore) PersistentSubscribeToStream(ctx context.Context, streamName string, groupName string) (Subscription, error) {
+	return nil, ErrPersistentSubscriptionNotSupported
+}
+
+func (s *inMemoryEventStore) CreatePersistentSubscription(ctx context.Context, streamName string, groupName string, options PersistentSubscriptionOptions) error {
+	return ErrPersistentSubscriptionNotSupported
+}
+
+func (s *inMemoryEventStore) SubscribeToAll(ctx context.Context, options SubscribeToAllOptions) (Subscription, error) {
+	filter, err := newEventFilter(options.Filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	next := len(s.log)
+
+	switch from := options.From.(type) {
+	case Start:
+		next = 0
+	case Position:
+		next = int(from.Commit)
+	}
+
+	return newInMemorySubscription(ctx, s, func(offset int) (*RecordedEvent, int, bool) {
+		for ; offset < len(s.log); offset++ {
+			if filter.matches(s.log[offset]) {
+				return s.log[offset], offset + 1, true
+			}
+		}
+
+		return nil, offset, false
+	}, next), nil
+}
+
+func (s *inMemoryEventStore) SubscribeToStream(ctx context.Context, streamID string, options SubscribeToStreamOptions) (Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	next := 0
+
+	if stream, ok := s.streams[streamID]; ok {
+		next = int(stream.revision + 1)
+	}
+
+	switch from := options.From.(type) {
+	case Start:
+		next = 0
+	case StreamRevision:
+		next = int(from.Value) + 1
+	}
+
+	return newInMemorySubscription(ctx, s, func(revision int) (*RecordedEvent, int, bool) {
+		stream, ok := s.streams[streamID]
+
+		if !ok {
+			return nil, revision, false
+		}
+
+		for _, recordedEvent := range stream.events {
+			if recordedEvent.EventNumber >= uint64(revision) {
+				return recordedEvent, int(recordedEvent.EventNumber) + 1, true
+			}
+		}
+
+		return nil, revision, false
+	}, next), nil
+}
+
+func (s *inMemoryEventStore) DeleteStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error {
+	return s.deleteStream(streamID, expectedRevision, false)
+}
+
+func (s *inMemoryEventStore) TombstoneStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error {
+	return s.deleteStream(streamID, expectedRevision, true)
+}
+
+// deleteStream drops the events of the stream but keeps its revision, so a
+// soft-deleted stream continues where it left off. The global log is left
+// untouched and subscriptions still see every event.
+func (s *inMemoryEventStore) deleteStream(streamID string, expectedRevision ExpectedRevision, tombstone bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stream, ok := s.streams[streamID]
+
+	if !ok {
+		stream = &inMemoryStream{revision: NoStreamRevision}
+	}
+
+	if stream.tombstoned {
+		return &StreamDeletedError{StreamID: streamID}
+	}
+
+	if !acceptsExpectedRevision(expectedRevision, stream.revision, ok && len(stream.events) > 0) {
+		return fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
+	}
+
+	stream.events = nil
+	stream.tombstoned = tombstone
+
+	if ok || tombstone {
+		s.streams[streamID] = stream
+	}
+
+	return nil
+}
+
+func (s *inMemoryEventStore) GetStreamMetadata(ctx context.Context, streamID string) (*StreamMetadata, error) {
+	return nil, ErrStreamMetadataNotSupported
+}
+
+func (s *inMemoryEventStore) SetStreamMetadata(ctx context.Context, streamID string, metadata StreamMetadata) error {
+	return ErrStreamMetadataNotSupported
+}
+
+func (s *inMemoryEventStore) GetMarshaller() EventMarshaller {
+	return s.eventMarshaller
+}
+
+func (stream *inMemoryStream) slice(options ReadStreamOptions) []*RecordedEvent {
+	var from int64
+
+	switch position := options.From.(type) {
+	case End:
+		from = stream.revision
+		if options.Direction == Forwards {
+			from++
+		}
+	case StreamRevision:
+		from = int64(position.Value)
+	}
+
+	var events []*RecordedEvent
+
+	if options.Direction == Backwards {
+		for i := len(stream.events) - 1; i >= 0; i-- {
+			if int64(stream.events[i].EventNumber) <= from {
+				events = append(events, stream.events[i])
+			}
+		}
+
+		return events
+	}
+
+	for _, recordedEvent := range stream.events {
+		if int64(recordedEvent.EventNumber) >= from {
+			events = append(events, recordedEvent)
+		}
+	}
+
+	return events
+}
+
+type inMemorySubscription struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	store  *inMemoryEventStore
+	next   func(cursor int) (*RecordedEvent, int, bool)
+	cursor int
+}
+
+func newInMemorySubscription(ctx context.Context, store *inMemoryEventStore, next func(cursor int) (*RecordedEvent, int, bool), cursor int) *inMemorySubscription {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &inMemorySubscription{
+		ctx:    ctx,
+		cancel: cancel,
+		store:  store,
+		next:   next,
+		cursor: cursor,
+	}
+}
+
+// Recv blocks until the next matching event is appended to the store or the
+// subscription is closed, in which case a SubscriptionDropped event is returned.
+func (sub *inMemorySubscription) Recv() *SubscriptionEvent {
+	for {
+		sub.store.mu.RLock()
+		recordedEvent, cursor, ok := sub.next(sub.cursor)
+		appended := sub.store.appended
+		sub.store.mu.RUnlock()
+
+		sub.cursor = cursor
+
+		if ok {
+			return &SubscriptionEvent{
+				EventAppeared: recordedEvent,
+			}
+		}
+
+		select {
+		case <-appended:
+		case <-sub.ctx.Done():
+			return &SubscriptionEvent{
+				SubscriptionDropped: &SubscriptionDropped{
+					Error: sub.ctx.Err(),
+				},
+			}
+		}
+	}
+}
+
+func (sub *inMemorySubscription) Close() error {
+	sub.cancel()
+	return nil
+}
@@ -0,0 +1,47 @@
+package esourcing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestInMemoryEventStore(t *testing.T) {
+	testEventStoreContract(t, func(t *testing.T) EventStore {
+		return NewInMemoryEventStore()
+	})
+}
+
+func TestReadAllReportsUndecodableEvents(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryEventStore()
+	registerCounterEvents(t, store)
+
+	if _, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 1, 2, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	store.(*inMemoryEventStore).log[1].Data = []byte("{")
+
+	events, err := store.ReadAll(ctx, ReadAllOptions{From: Start{}}, 10)
+
+	var undecodable *UndecodableEventError
+
+	if !errors.As(err, &undecodable) {
+		t.Fatalf("expected UndecodableEventError, got %v", err)
+	}
+
+	if len(events) != 1 || events[0].RecordedEvent == nil || events[0].RecordedEvent.EventNumber != 0 {
+		t.Fatalf("expected the event read before, got %+v", events)
+	}
+
+	if undecodable.RecordedEvent.EventNumber != 1 {
+		t.Fatalf("expected the second event to be undecodable, got %+v", undecodable.RecordedEvent)
+	}
+
+	events, err = store.ReadAll(ctx, ReadAllOptions{From: undecodable.RecordedEvent.Position}, 10)
+
+	if err != nil || len(events) != 1 || events[0].Event.(counterIncremented).By != 3 {
+		t.Fatalf("expected to read on past the undecodable event, got %+v, %v", events, err)
+	}
+}
@@ -0,0 +1,200 @@
+package esourcing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type inMemoryKeyStore struct {
+	mu        sync.Mutex
+	keys      map[string][]byte
+	forgotten map[string]bool
+}
+
+func NewInMemoryKeyStore() KeyStore {
+	return &inMemoryKeyStore{
+		keys:      map[string][]byte{},
+		forgotten: map[string]bool{},
+	}
+}
+
+func (s *inMemoryKeyStore) GetOrCreateKey(ctx context.Context, subjectID string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.forgotten[subjectID] {
+		return nil, fmt.Errorf("%w: subject %s", ErrSubjectForgotten, subjectID)
+	}
+
+	if key, ok := s.keys[subjectID]; ok {
+		return key, nil
+	}
+
+	key, err := newEncryptionKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.keys[subjectID] = key
+
+	return key, nil
+}
+
+func (s *inMemoryKeyStore) GetKey(ctx context.Context, subjectID string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.forgotten[subjectID] {
+		return nil, fmt.Errorf("%w: subject %s", ErrSubjectForgotten, subjectID)
+	}
+
+	key, ok := s.keys[subjectID]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: subject %s", ErrKeyNotFound, subjectID)
+	}
+
+	return key, nil
+}
+
+func (s *inMemoryKeyStore) ForgetSubject(ctx context.Context, subjectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, subjectID)
+	s.forgotten[subjectID] = true
+
+	return nil
+}
+
+type sqlKeyStore struct {
+	db *sql.DB
+}
+
+// NewSQLKeyStore returns a KeyStore that keeps the encryption key of each
+// subject in the es_subject_key table, and the forgotten subjects in the
+// es_forgotten_subject table.
+func NewSQLKeyStore(db *sql.DB) KeyStore {
+	return &sqlKeyStore{
+		db: db,
+	}
+}
+
+// CreateSQLKeyStoreSchema creates the key store tables when they do not exist
+// yet.
+func CreateSQLKeyStoreSchema(db *sql.DB, dialect SQLDialect) error {
+	for _, query := range append(dialect.KeyStoreSchema(), dialect.ForgottenSubjectSchema()...) {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("error creating %s key store schema: %w", dialect, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlKeyStore) GetOrCreateKey(ctx context.Context, subjectID string) ([]byte, error) {
+	key, err := s.GetKey(ctx, subjectID)
+
+	if !errors.Is(err, ErrKeyNotFound) {
+		return key, err
+	}
+
+	key, err = newEncryptionKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO es_subject_key (subject_id, encryption_key, created_at) VALUES (?, ?, ?)", subjectID, key, time.Now().UnixNano())
+
+	// Another writer created the key of the subject first, use theirs.
+	if isUniqueViolation(err) {
+		return s.GetKey(ctx, subjectID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error when creating encryption key of subject %s: %w", subjectID, err)
+	}
+
+	// The subject may have been forgotten since GetKey. ForgetSubject records
+	// the subject before deleting its key, so either it deleted the new key
+	// too or the subject shows up here.
+	forgotten, err := s.isForgotten(ctx, subjectID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if forgotten {
+		if err := s.ForgetSubject(ctx, subjectID); err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: subject %s", ErrSubjectForgotten, subjectID)
+	}
+
+	return key, nil
+}
+
+func (s *sqlKeyStore) GetKey(ctx context.Context, subjectID string) ([]byte, error) {
+	forgotten, err := s.isForgotten(ctx, subjectID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if forgotten {
+		return nil, fmt.Errorf("%w: subject %s", ErrSubjectForgotten, subjectID)
+	}
+
+	var key []byte
+
+	err = s.db.QueryRowContext(ctx, "SELECT encryption_key FROM es_subject_key WHERE subject_id = ?", subjectID).Scan(&key)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: subject %s", ErrKeyNotFound, subjectID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error when getting encryption key of subject %s: %w", subjectID, err)
+	}
+
+	return key, nil
+}
+
+func (s *sqlKeyStore) ForgetSubject(ctx context.Context, subjectID string) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO es_forgotten_subject (subject_id, forgotten_at) VALUES (?, ?)", subjectID, time.Now().UnixNano())
+
+	if err != nil && !isUniqueViolation(err) {
+		return fmt.Errorf("error when forgetting subject %s: %w", subjectID, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM es_subject_key WHERE subject_id = ?", subjectID)
+
+	if err != nil {
+		return fmt.Errorf("error when forgetting subject %s: %w", subjectID, err)
+	}
+
+	return nil
+}
+
+func (s *sqlKeyStore) isForgotten(ctx context.Context, subjectID string) (bool, error) {
+	var forgotten int
+
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM es_forgotten_subject WHERE subject_id = ?", subjectID).Scan(&forgotten)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error when checking whether subject %s was forgotten: %w", subjectID, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package esourcing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type gzipCompressor struct {
+	level   int
+	writers *sync.Pool
+}
+
+// NewGzipCompressor returns a compressor using gzip at the given level, see
+// the compress/gzip constants.
+func NewGzipCompressor(level int) PayloadCompressor {
+	return gzipCompressor{
+		level:   level,
+		writers: &sync.Pool{},
+	}
+}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// Writers are reused as each one allocates large compression tables.
+	writer, ok := c.writers.Get().(*gzip.Writer)
+
+	if ok {
+		writer.Reset(&buf)
+	} else {
+		var err error
+
+		writer, err = gzip.NewWriterLevel(&buf, c.level)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	defer c.writers.Put(writer)
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// CompressPayloads compresses the payload of new events once it is larger
+// than threshold bytes. The compressor is recorded in the event metadata, and
+// events are decompressed on read with any compressor passed here before,
+// along with gzip, which is always known.
+func (em *eventMarshaller) CompressPayloads(compressor PayloadCompressor, threshold int) {
+	em.compressors[compressor.Name()] = compressor
+	em.compressor = compressor
+	em.compressionThreshold = threshold
+}
+
+func (em *eventMarshaller) compress(data []byte) ([]byte, string, error) {
+	if em.compressor == nil || len(data) <= em.compressionThreshold {
+		return data, "", nil
+	}
+
+	compressed, err := em.compressor.Compress(data)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Keep small payloads that do not shrink as they are.
+	if len(compressed) >= len(data) {
+		return data, "", nil
+	}
+
+	return compressed, em.compressor.Name(), nil
+}
+
+func (em *eventMarshaller) decompress(data []byte, compression string) ([]byte, error) {
+	if compression == "" {
+		return data, nil
+	}
+
+	compressor, ok := em.compressors[compression]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown payload compression %s", compression)
+	}
+
+	return compressor.Decompress(data)
+}
@@ -0,0 +1,266 @@
+package esourcing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const noteContentType = ContentType("text/x-note")
+
+type noteWritten struct {
+	EventBase
+	Text string `json:"text"`
+}
+
+func (e noteWritten) Version() string {
+	return "v1"
+}
+
+// noteSerializer stores the text of notes as is, standing in for serializers
+// other than JSON.
+type noteSerializer struct{}
+
+func (noteSerializer) ContentType() ContentType {
+	return noteContentType
+}
+
+func (noteSerializer) Marshal(event Event) ([]byte, error) {
+	return []byte(event.(noteWritten).Text), nil
+}
+
+func (noteSerializer) Unmarshal(data []byte, event interface{}) error {
+	event.(*noteWritten).Text = string(data)
+	return nil
+}
+
+func newNoteMarshaller(t testing.TB) EventMarshaller {
+	t.Helper()
+
+	registry := NewEventTypeRegistry()
+
+	if err := registry.Register((*noteWritten)(nil), "NoteWritten"); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewEventMarshaller(registry)
+}
+
+func newNote(text string) noteWritten {
+	note := noteWritten{Text: text}
+	note.setEventBase(NewEventBaseForAggregate("note", "n1", "NoteWritten", time.Now()))
+
+	return note
+}
+
+// recordEvent returns the event data as a store would read it back.
+func recordEvent(eventData EventData) *RecordedEvent {
+	return &RecordedEvent{
+		EventID:     eventData.EventID,
+		EventType:   eventData.EventType,
+		ContentType: eventData.ContentType,
+		StreamID:    "note#n1",
+		Data:        eventData.Data,
+		Metadata:    eventData.Metadata,
+	}
+}
+
+func storedMetadata(t testing.TB, eventData EventData) eventMetadataRecord {
+	t.Helper()
+
+	var metadata eventMetadataRecord
+
+	if err := json.Unmarshal(eventData.Metadata, &metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	return metadata
+}
+
+func randomText(t testing.TB, size int) string {
+	t.Helper()
+
+	data := make([]byte, size)
+
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(data)[:size]
+}
+
+func TestCompressPayloadsThreshold(t *testing.T) {
+	ctx := context.Background()
+	marshaller := newNoteMarshaller(t)
+	marshaller.CompressPayloads(NewGzipCompressor(gzip.BestSpeed), 1024)
+
+	for name, test := range map[string]struct {
+		text       string
+		compressed bool
+	}{
+		"below the threshold":      {text: strings.Repeat("a", 1000), compressed: false},
+		"above the threshold":      {text: strings.Repeat("a", 2000), compressed: true},
+		"not shrinking when large": {text: randomText(t, 2000), compressed: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			eventData, err := marshaller.ToEventData(ctx, newNote(test.text))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			metadata := storedMetadata(t, eventData)
+
+			if !test.compressed {
+				if eventData.ContentType != JsonContentType || metadata.Compression != "" {
+					t.Fatalf("expected an uncompressed JSON payload, got %s compressed with %q", eventData.ContentType, metadata.Compression)
+				}
+
+				return
+			}
+
+			if eventData.ContentType != BinaryContentType || metadata.Compression != "gzip" || metadata.ContentType != JsonContentType {
+				t.Fatalf("expected a gzip payload of JSON, got %s compressed with %q, holding %s", eventData.ContentType, metadata.Compression, metadata.ContentType)
+			}
+
+			if len(eventData.Data) >= len(test.text) {
+				t.Fatalf("expected the payload to shrink, got %d bytes", len(eventData.Data))
+			}
+		})
+	}
+}
+
+func TestCompressedPayloadRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	marshaller := newNoteMarshaller(t)
+	marshaller.RegisterSerializer(noteSerializer{})
+	marshaller.CompressPayloads(NewGzipCompressor(gzip.BestSpeed), 0)
+
+	if err := marshaller.UseSerializer("NoteWritten", noteContentType); err != nil {
+		t.Fatal(err)
+	}
+
+	note := newNote(strings.Repeat("note ", 100))
+	eventData, err := marshaller.ToEventData(ctx, note)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := storedMetadata(t, eventData)
+
+	// The store only sees binary data, the metadata keeps the content type of
+	// the serializer.
+	if eventData.ContentType != BinaryContentType || metadata.ContentType != noteContentType || metadata.Compression != "gzip" {
+		t.Fatalf("unexpected %s payload holding %s compressed with %q", eventData.ContentType, metadata.ContentType, metadata.Compression)
+	}
+
+	if bytes.Contains(eventData.Data, []byte("note")) {
+		t.Fatal("expected the payload to be compressed")
+	}
+
+	decoded, err := marshaller.FromRecordedEvent(ctx, recordEvent(eventData))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.(noteWritten).Text != note.Text || decoded.EventID() != note.EventID() || decoded.AggregateID() != "n1" {
+		t.Fatalf("unexpected decoded event %+v", decoded)
+	}
+
+	// Marshallers read gzip payloads even without compressing themselves.
+	reader := newNoteMarshaller(t)
+	reader.RegisterSerializer(noteSerializer{})
+
+	if decoded, err = reader.FromRecordedEvent(ctx, recordEvent(eventData)); err != nil || decoded.(noteWritten).Text != note.Text {
+		t.Fatalf("expected the note to be read without compression enabled, got %+v, %v", decoded, err)
+	}
+}
+
+func TestMixedCompressionStream(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteEventStore(t)
+
+	if err := store.RegisterEventType((*noteWritten)(nil), "NoteWritten"); err != nil {
+		t.Fatal(err)
+	}
+
+	texts := []string{"short", strings.Repeat("long ", 500), "short again", strings.Repeat("longer ", 500)}
+
+	_, err := store.AppendToStream(ctx, "note#n1", NoStream{}, []Event{newNote(texts[0]), newNote(texts[1])})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compression only applies to the events appended once it is enabled.
+	store.GetMarshaller().CompressPayloads(NewGzipCompressor(gzip.BestSpeed), 100)
+
+	_, err = store.AppendToStream(ctx, "note#n1", Revision(1), []Event{newNote(texts[2]), newNote(texts[3])})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ReadFullStream(ctx, store, "note#n1", ReadStreamOptions{Direction: Forwards, From: Start{}}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != len(texts) {
+		t.Fatalf("expected %d events, got %d", len(texts), len(events))
+	}
+
+	for i, evt := range events {
+		if text := evt.(noteWritten).Text; text != texts[i] {
+			t.Fatalf("expected event %d to be %q, got %q", i, texts[i], text)
+		}
+	}
+}
+
+// cartItemsPayload returns size bytes of a JSON list of cart items, like a
+// large cart event would hold.
+func cartItemsPayload(size int) []byte {
+	var payload strings.Builder
+
+	for i := 0; payload.Len() < size; i++ {
+		fmt.Fprintf(&payload, `{"product_id":"%d","name":"Product %d","price":%d.5,"quantity":%d},`, 100+i, i, 10+i%7, 1+i%3)
+	}
+
+	return []byte(payload.String()[:size])
+}
+
+// BenchmarkGzipPayloadSize reports the size of compressed payloads in percent
+// of the original, to pick the threshold passed to CompressPayloads.
+func BenchmarkGzipPayloadSize(b *testing.B) {
+	compressor := NewGzipCompressor(gzip.BestSpeed)
+
+	for _, size := range []int{64, 128, 256, 512, 1024, 4096} {
+		data := cartItemsPayload(size)
+
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			var compressed []byte
+			var err error
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+
+			for i := 0; i < b.N; i++ {
+				if compressed, err = compressor.Compress(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(100*float64(len(compressed))/float64(len(data)), "%size")
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package esourcing
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var ErrKeyNotFound = fmt.Errorf("encryption key not found")
+var ErrSubjectForgotten = fmt.Errorf("subject forgotten")
+
+// personalDataTag marks event fields holding personal data. The field naming
+// the data subject is tagged `pii:"subject"` and the string fields to encrypt
+// with the key of that subject are tagged `pii:"data"`. Events without a
+// subject field use their aggregate ID as subject.
+const personalDataTag = "pii"
+
+type personalDataFields struct {
+	subject []int
+	data    [][]int
+}
+
+// personalDataEncryption encrypts the personal data fields of events with
+// AES-GCM, using one key per subject. Once a subject is forgotten, its fields
+// are read back as empty strings, and new events are stored without them.
+// Events stored before encryption was enabled keep their fields in clear.
+type personalDataEncryption struct {
+	keyStore KeyStore
+	fields   sync.Map
+}
+
+// EncryptPersonalData enables field-level encryption of the event fields
+// tagged as personal data, with the keys kept in keyStore.
+func (em *eventMarshaller) EncryptPersonalData(keyStore KeyStore) {
+	em.encryption = &personalDataEncryption{
+		keyStore: keyStore,
+	}
+}
+
+// personalDataEncryptionOf returns the personal data encryption of the event
+// marshaller of the store, if enabled, to encrypt snapshots the same way.
+func personalDataEncryptionOf(store EventStore) *personalDataEncryption {
+	marshaller, ok := store.GetMarshaller().(*eventMarshaller)
+
+	if !ok {
+		return nil
+	}
+
+	return marshaller.encryption
+}
+
+// encrypt returns a copy of the event with its personal data fields
+// encrypted, and whether any field was.
+func (pe *personalDataEncryption) encrypt(ctx context.Context, event Event) (Event, bool, error) {
+	copied := reflect.New(reflect.TypeOf(event)).Elem()
+	copied.Set(reflect.ValueOf(event))
+
+	encrypted, err := pe.encryptFields(ctx, copied, event.AggregateID())
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error when encrypting event %s: %w", event.EventType(), err)
+	}
+
+	return copied.Interface().(Event), encrypted, nil
+}
+
+// encryptFields encrypts in place the personal data fields of the struct v,
+// or clears them when the subject was forgotten, and returns whether any
+// field was encrypted. The subject defaults to defaultSubjectID.
+func (pe *personalDataEncryption) encryptFields(ctx context.Context, v reflect.Value, defaultSubjectID string) (bool, error) {
+	fields, err := pe.fieldsOf(v.Type())
+
+	if err != nil || !fields.holdData(v) {
+		return false, err
+	}
+
+	subjectID := pe.subjectID(v, fields, defaultSubjectID)
+
+	if subjectID == "" {
+		return false, fmt.Errorf("%s holds personal data without a subject", v.Type().Name())
+	}
+
+	key, err := pe.keyStore.GetOrCreateKey(ctx, subjectID)
+
+	if err != nil && !errors.Is(err, ErrSubjectForgotten) {
+		return false, fmt.Errorf("error when getting encryption key of subject %s: %w", subjectID, err)
+	}
+
+	for _, index := range fields.data {
+		field := v.FieldByIndex(index)
+
+		if field.String() == "" {
+			continue
+		}
+
+		if key == nil {
+			field.SetString("")
+			continue
+		}
+
+		encrypted, err := encryptString(key, field.String())
+
+		if err != nil {
+			return false, err
+		}
+
+		field.SetString(encrypted)
+	}
+
+	return key != nil, nil
+}
+
+// decrypt decrypts in place the personal data fields of the event pointed to
+// by eventPtr, which must have been stored encrypted, or clears them when the
+// subject was forgotten or has no key.
+func (pe *personalDataEncryption) decrypt(ctx context.Context, eventPtr reflect.Value, aggregateID string) error {
+	event := eventPtr.Elem()
+	fields, err := pe.fieldsOf(event.Type())
+
+	if err != nil || !fields.holdData(event) {
+		return err
+	}
+
+	subjectID := pe.subjectID(event, fields, aggregateID)
+	key, err := pe.keyStore.GetKey(ctx, subjectID)
+
+	if err != nil && !errors.Is(err, ErrKeyNotFound) && !errors.Is(err, ErrSubjectForgotten) {
+		return fmt.Errorf("error when getting encryption key of subject %s: %w", subjectID, err)
+	}
+
+	for _, index := range fields.data {
+		field := event.FieldByIndex(index)
+
+		if field.String() == "" {
+			continue
+		}
+
+		if key == nil {
+			field.SetString("")
+			continue
+		}
+
+		decrypted, err := decryptString(key, field.String())
+
+		// The subject may have been forgotten since its key was read.
+		if err != nil && pe.forgotten(ctx, subjectID) {
+			field.SetString("")
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("error when decrypting %s: %w", event.Type().Name(), err)
+		}
+
+		field.SetString(decrypted)
+	}
+
+	return nil
+}
+
+// holdData tells whether any personal data field of the struct v is set.
+func (f personalDataFields) holdData(v reflect.Value) bool {
+	for _, index := range f.data {
+		if v.FieldByIndex(index).String() != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encryptState encrypts the personal data fields of a JSON snapshot state,
+// decoded into the struct state points to.
+func (pe *personalDataEncryption) encryptState(ctx context.Context, data []byte, state interface{}, aggregateID string) ([]byte, error) {
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	if _, err := pe.encryptFields(ctx, reflect.ValueOf(state).Elem(), aggregateID); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(state)
+}
+
+// decryptState decrypts the personal data fields of a JSON snapshot state.
+// Unlike events, it fails when the subject has no key or the fields are not
+// encrypted, as the snapshot was taken before the subject was forgotten or
+// encryption was enabled, and the events should be replayed instead.
+func (pe *personalDataEncryption) decryptState(ctx context.Context, data []byte, state interface{}, aggregateID string) ([]byte, error) {
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(state).Elem()
+	fields, err := pe.fieldsOf(v.Type())
+
+	if err != nil || !fields.holdData(v) {
+		return data, err
+	}
+
+	subjectID := pe.subjectID(v, fields, aggregateID)
+	key, err := pe.keyStore.GetKey(ctx, subjectID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range fields.data {
+		field := v.FieldByIndex(index)
+
+		if field.String() == "" {
+			continue
+		}
+
+		decrypted, err := decryptString(key, field.String())
+
+		if err != nil {
+			return nil, err
+		}
+
+		field.SetString(decrypted)
+	}
+
+	return json.Marshal(state)
+}
+
+func (pe *personalDataEncryption) forgotten(ctx context.Context, subjectID string) bool {
+	_, err := pe.keyStore.GetKey(ctx, subjectID)
+
+	return errors.Is(err, ErrSubjectForgotten) || errors.Is(err, ErrKeyNotFound)
+}
+
+func (pe *personalDataEncryption) subjectID(event reflect.Value, fields personalDataFields, aggregateID string) string {
+	if fields.subject == nil {
+		return aggregateID
+	}
+
+	return event.FieldByIndex(fields.subject).String()
+}
+
+func (pe *personalDataEncryption) fieldsOf(t reflect.Type) (personalDataFields, error) {
+	if cached, ok := pe.fields.Load(t); ok {
+		return cached.(personalDataFields), nil
+	}
+
+	var fields personalDataFields
+
+	for _, field := range reflect.VisibleFields(t) {
+		tag, ok := field.Tag.Lookup(personalDataTag)
+
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		if field.Type.Kind() != reflect.String {
+			return fields, fmt.Errorf("personal data field %s.%s must be a string", t.Name(), field.Name)
+		}
+
+		switch strings.TrimSpace(tag) {
+		case "subject":
+			fields.subject = field.Index
+		case "data":
+			fields.data = append(fields.data, field.Index)
+		default:
+			return fields, fmt.Errorf("invalid %s tag %q on %s.%s", personalDataTag, tag, t.Name(), field.Name)
+		}
+	}
+
+	pe.fields.Store(t, fields)
+
+	return fields, nil
+}
+
+func encryptString(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+func decryptString(key []byte, encrypted string) (string, error) {
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted value too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func newEncryptionKey() ([]byte, error) {
+	key := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
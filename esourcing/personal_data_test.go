@@ -0,0 +1,219 @@
+package esourcing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type customerRenamed struct {
+	EventBase
+	Name string `json:"name" pii:"data"`
+}
+
+func (e customerRenamed) Version() string {
+	return "v1"
+}
+
+type customer struct {
+	*AggregateRoot
+	name string
+}
+
+func newCustomer(id string) *customer {
+	c := &customer{
+		AggregateRoot: NewAggregateRoot("customer", id),
+	}
+
+	On(c, func(e customerRenamed) {
+		c.name = e.Name
+	})
+
+	return c
+}
+
+type customerSnapshot struct {
+	Name string `json:"name" pii:"data"`
+}
+
+func (c *customer) Snapshot() ([]byte, error) {
+	return json.Marshal(customerSnapshot{Name: c.name})
+}
+
+func (c *customer) RestoreSnapshot(state []byte) error {
+	var snapshot customerSnapshot
+
+	if err := json.Unmarshal(state, &snapshot); err != nil {
+		return err
+	}
+
+	c.name = snapshot.Name
+
+	return nil
+}
+
+func (c *customer) NewSnapshotState() interface{} {
+	return &customerSnapshot{}
+}
+
+func TestForgottenSubjectStaysRedacted(t *testing.T) {
+	for name, newKeyStore := range map[string]func(t *testing.T) KeyStore{
+		"in memory": func(t *testing.T) KeyStore {
+			return NewInMemoryKeyStore()
+		},
+		"sql": func(t *testing.T) KeyStore {
+			db := newSQLiteDB(t)
+
+			if err := CreateSQLKeyStoreSchema(db, SQLiteDialect); err != nil {
+				t.Fatal(err)
+			}
+
+			return NewSQLKeyStore(db)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			keyStore := newKeyStore(t)
+			store := newSQLiteEventStore(t)
+			store.GetMarshaller().EncryptPersonalData(keyStore)
+
+			if err := store.RegisterEventType((*customerRenamed)(nil), "CustomerRenamed"); err != nil {
+				t.Fatal(err)
+			}
+
+			repository := NewRepository(store, "customer", newCustomer, RepositoryConfig{})
+			c := newCustomer("alice")
+			AppendEvent(ctx, c, customerRenamed{Name: "Alice"})
+
+			if err := repository.Save(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := keyStore.ForgetSubject(ctx, "alice"); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := repository.Load(ctx, "alice")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			AppendEvent(ctx, c, customerRenamed{Name: "Alice Smith"})
+
+			if err := repository.Save(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := keyStore.GetOrCreateKey(ctx, "alice"); !errors.Is(err, ErrSubjectForgotten) {
+				t.Fatalf("expected ErrSubjectForgotten, got %v", err)
+			}
+
+			events, err := ReadFullStream(ctx, store, "customer#alice", ReadStreamOptions{Direction: Forwards, From: Start{}}, 0)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(events) != 2 {
+				t.Fatalf("expected 2 events, got %d", len(events))
+			}
+
+			for _, evt := range events {
+				if name := evt.(customerRenamed).Name; name != "" {
+					t.Fatalf("expected the name to be redacted, got %q", name)
+				}
+			}
+		})
+	}
+}
+
+func TestEventsStoredBeforeEncryptionStayReadable(t *testing.T) {
+	ctx := context.Background()
+	keyStore := NewInMemoryKeyStore()
+	store := newSQLiteEventStore(t)
+
+	if err := store.RegisterEventType((*customerRenamed)(nil), "CustomerRenamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	repository := NewRepository(store, "customer", newCustomer, RepositoryConfig{})
+	c := newCustomer("alice")
+	AppendEvent(ctx, c, customerRenamed{Name: "Alice"})
+
+	if err := repository.Save(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	store.GetMarshaller().EncryptPersonalData(keyStore)
+
+	AppendEvent(ctx, c, customerRenamed{Name: "Alice Smith"})
+
+	if err := repository.Save(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := repository.Load(ctx, "alice"); err != nil || c.name != "Alice Smith" {
+		t.Fatalf("expected the encrypted name, got %+v, %v", c, err)
+	}
+
+	if err := keyStore.ForgetSubject(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ReadFullStream(ctx, store, "customer#alice", ReadStreamOptions{Direction: Forwards, From: Start{}}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{events[0].(customerRenamed).Name, events[1].(customerRenamed).Name}
+
+	if names[0] != "Alice" || names[1] != "" {
+		t.Fatalf("expected only the encrypted name to be redacted, got %q", names)
+	}
+}
+
+func TestSnapshotPersonalDataIsEncrypted(t *testing.T) {
+	ctx := context.Background()
+	keyStore := NewInMemoryKeyStore()
+	store := newSQLiteEventStore(t)
+	store.GetMarshaller().EncryptPersonalData(keyStore)
+
+	if err := store.RegisterEventType((*customerRenamed)(nil), "CustomerRenamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshotStore, err := NewEventStoreSnapshotStore(store, StreamNaming{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository := NewRepository(store, "customer", newCustomer, RepositoryConfig{SnapshotStore: snapshotStore, SnapshotPolicy: SnapshotEvery(1)})
+	c := newCustomer("alice")
+	AppendEvent(ctx, c, customerRenamed{Name: "Alice"})
+
+	if err := repository.Save(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := snapshotStore.LoadSnapshot(ctx, "customer", "alice")
+
+	if err != nil || snapshot == nil || bytes.Contains(snapshot.State, []byte("Alice")) {
+		t.Fatalf("expected an encrypted snapshot, got %+v, %v", snapshot, err)
+	}
+
+	if c, err := repository.Load(ctx, "alice"); err != nil || c.name != "Alice" {
+		t.Fatalf("expected the name from the snapshot, got %+v, %v", c, err)
+	}
+
+	if err := keyStore.ForgetSubject(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := repository.Load(ctx, "alice"); err != nil || c.name != "" {
+		t.Fatalf("expected the name to be redacted, got %+v, %v", c, err)
+	}
+}
@@ -0,0 +1,78 @@
+package esourcing
+
+import (
+	"context"
+	"strings"
+)
+
+// readAllBatch reads up to batchSize raw events of the global log past from in
+// the given direction, and reports whether the log has no more events.
+type readAllBatch func(ctx context.Context, direction Direction, from AllPosition, batchSize uint64) ([]*RecordedEvent, bool, error)
+
+// readAll implements ReadAll on top of a store specific batch read. Filters
+// are applied here rather than by the store, so it keeps reading batches until
+// count events match or the log is exhausted.
+func readAll(ctx context.Context, marshaller EventMarshaller, options ReadAllOptions, count uint64, readBatch readAllBatch) ([]ResolvedEvent, error) {
+	filter, err := newEventFilter(options.Filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	from := options.From
+
+	if from == nil {
+		from = Start{}
+
+		if options.Direction == Backwards {
+			from = End{}
+		}
+	}
+
+	var events []ResolvedEvent
+
+	for uint64(len(events)) < count {
+		recordedEvents, exhausted, err := readBatch(ctx, options.Direction, from, count)
+
+		if err != nil {
+			return events, err
+		}
+
+		for _, recordedEvent := range recordedEvents {
+			from = recordedEvent.Position
+
+			if isSystemEvent(recordedEvent) || !filter.matches(recordedEvent) {
+				continue
+			}
+
+			event, err := marshaller.FromRecordedEvent(ctx, recordedEvent)
+
+			if err != nil {
+				return events, &UndecodableEventError{RecordedEvent: recordedEvent, Err: err}
+			}
+
+			events = append(events, ResolvedEvent{
+				Event:         event,
+				StreamID:      recordedEvent.StreamID,
+				Position:      recordedEvent.Position,
+				RecordedEvent: recordedEvent,
+			})
+
+			if uint64(len(events)) == count {
+				return events, nil
+			}
+		}
+
+		if exhausted {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// isSystemEvent reports whether the event was written by the store itself, like
+// the EventStoreDB $metadata and $settings events.
+func isSystemEvent(recordedEvent *RecordedEvent) bool {
+	return strings.HasPrefix(recordedEvent.EventType, "$") || strings.HasPrefix(recordedEvent.StreamID, "$")
+}
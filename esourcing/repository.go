@@ -0,0 +1,352 @@
+package esourcing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrAggregateNotFound = fmt.Errorf("aggregate not found")
+
+// StreamMetadataPolicy returns the metadata to set on the aggregate stream
+// after the given events were committed to it, or nil to leave it as it is.
+type StreamMetadataPolicy func(agg Aggregate, committed []Event) *StreamMetadata
+
+// StreamMaxAge expires the events of aggregate streams after maxAge, from the
+// time they are created.
+func StreamMaxAge(maxAge time.Duration) StreamMetadataPolicy {
+	return func(agg Aggregate, committed []Event) *StreamMetadata {
+		if agg.StreamRevision()+1 != int64(len(committed)) {
+			return nil
+		}
+
+		return &StreamMetadata{MaxAge: maxAge}
+	}
+}
+
+// StreamMaxAgeUntil is like StreamMaxAge, but stops expiring the stream once
+// one of the given event types is committed, e.g. to only expire abandoned
+// shopping carts.
+func StreamMaxAgeUntil(maxAge time.Duration, eventTypes ...string) StreamMetadataPolicy {
+	expire := StreamMaxAge(maxAge)
+
+	return func(agg Aggregate, committed []Event) *StreamMetadata {
+		if committedAny(committed, eventTypes) {
+			return &StreamMetadata{}
+		}
+
+		return expire(agg, committed)
+	}
+}
+
+type RepositoryConfig struct {
+	// StreamNaming names aggregate streams with the aggregate type as category
+	// and the aggregate ID.
+	StreamNaming StreamNaming
+	// SnapshotStore and SnapshotPolicy are optional. When both are set, the
+	// aggregate must implement Snapshotter.
+	SnapshotStore  SnapshotStore
+	SnapshotPolicy SnapshotPolicy
+	// ReadBatchSize is the number of events read per page when loading an
+	// aggregate. It defaults to DefaultReadBatchSize.
+	ReadBatchSize uint64
+	// StreamMetadata is applied to the stream, and to the snapshot stream of
+	// stream-backed snapshot stores, after each save. Stores without stream
+	// metadata support ignore it.
+	StreamMetadata StreamMetadataPolicy
+}
+
+// Repository loads and saves event-sourced aggregates of one type.
+type Repository[T Aggregate] struct {
+	store         EventStore
+	aggregateType AggregateType
+	factory       func(aggregateID string) T
+	config        RepositoryConfig
+}
+
+// NewRepository returns a repository for aggregates of aggregateType. The
+// factory must return an aggregate without events, which is then rebuilt
+// from its snapshot and stream.
+func NewRepository[T Aggregate](store EventStore, aggregateType AggregateType, factory func(aggregateID string) T, config RepositoryConfig) *Repository[T] {
+	return &Repository[T]{
+		store:         store,
+		aggregateType: aggregateType,
+		factory:       factory,
+		config:        config,
+	}
+}
+
+// StreamName returns the stream of the aggregate, failing with
+// ErrInvalidStreamName for invalid aggregate IDs.
+func (r *Repository[T]) StreamName(aggregateID string) (StreamName, error) {
+	return r.config.StreamNaming.New(string(r.aggregateType), aggregateID)
+}
+
+// Load rebuilds the aggregate from its latest snapshot, if any, and the
+// events appended after it. It returns ErrAggregateNotFound when the
+// aggregate stream does not exist, has no events or was deleted, wrapping
+// StreamDeletedError for tombstoned streams. Snapshots left over from a stream
+// whose events expired are ignored.
+func (r *Repository[T]) Load(ctx context.Context, aggregateID string) (agg T, err error) {
+	streamName, err := r.StreamName(aggregateID)
+
+	if err != nil {
+		return agg, err
+	}
+
+	options := ReadStreamOptions{
+		Direction: Forwards,
+		From:      Start{},
+	}
+
+	snapshot, err := r.loadSnapshot(ctx, aggregateID)
+
+	if err != nil {
+		return agg, err
+	}
+
+	// The stream is read from the snapshotted event, and not the one after it,
+	// to tell whether the stream still holds events.
+	if snapshot != nil {
+		options.From = Revision(uint64(snapshot.Revision))
+	}
+
+	events, err := ReadFullStream(ctx, r.store, streamName.String(), options, r.config.ReadBatchSize)
+
+	if errors.Is(err, ErrStreamNotFound) {
+		return agg, fmt.Errorf("%w: %s %s", ErrAggregateNotFound, r.aggregateType, aggregateID)
+	}
+
+	var streamDeletedError *StreamDeletedError
+
+	if errors.As(err, &streamDeletedError) {
+		return agg, fmt.Errorf("%w: %s %s: %w", ErrAggregateNotFound, r.aggregateType, aggregateID, err)
+	}
+
+	if err != nil {
+		return agg, err
+	}
+
+	// Stores may read an existing stream without events, like EventStoreDB
+	// once they expired, which leaves nothing to rebuild the aggregate from.
+	if len(events) == 0 {
+		return agg, fmt.Errorf("%w: %s %s", ErrAggregateNotFound, r.aggregateType, aggregateID)
+	}
+
+	agg = r.factory(aggregateID)
+
+	if snapshot != nil {
+		if events[0].SequenceNumber() == snapshot.Revision {
+			events = events[1:]
+		}
+
+		return agg, RebuildFromSnapshot(agg, snapshot, events)
+	}
+
+	return agg, RebuildFromEvents(agg, events)
+}
+
+// Save appends the uncommitted events of the aggregate to its stream, expecting
+// the stream to be at the revision the aggregate was loaded at. It returns
+// ErrConcurrencyConflict when the stream was modified in the meantime.
+func (r *Repository[T]) Save(ctx context.Context, agg T) error {
+	uncommitedEvents := agg.UncommittedEvents()
+
+	if len(uncommitedEvents) == 0 {
+		return nil
+	}
+
+	streamName, err := r.StreamName(agg.AggregateID())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = r.store.AppendToStream(ctx, streamName.String(), ExpectedRevisionFor(agg), uncommitedEvents)
+
+	if err != nil {
+		return err
+	}
+
+	agg.SetStreamRevision(agg.StreamRevision() + int64(len(uncommitedEvents)))
+	Commit(agg)
+
+	r.setStreamMetadata(ctx, streamName, agg, uncommitedEvents)
+	r.saveSnapshot(ctx, agg, uncommitedEvents)
+
+	return nil
+}
+
+// Exists tells whether Load would find the aggregate, without rebuilding it.
+func (r *Repository[T]) Exists(ctx context.Context, aggregateID string) (bool, error) {
+	streamName, err := r.StreamName(aggregateID)
+
+	if err != nil {
+		return false, err
+	}
+
+	events, err := r.store.ReadStream(ctx, streamName.String(), ReadStreamOptions{
+		Direction: Forwards,
+		From:      Start{},
+	}, 1)
+
+	var streamDeletedError *StreamDeletedError
+
+	if errors.Is(err, ErrStreamNotFound) || errors.As(err, &streamDeletedError) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(events) > 0, nil
+}
+
+// Delete saves the uncommitted events of the aggregate, usually a final event
+// recording the deletion, and then soft-deletes its stream and snapshot.
+// Appending to the stream again brings the aggregate back.
+func (r *Repository[T]) Delete(ctx context.Context, agg T) error {
+	return r.delete(ctx, agg, false)
+}
+
+// Tombstone is like Delete but deletes the stream permanently, the aggregate
+// id can never be used again. The snapshot stream of stores implementing
+// SnapshotTombstoner is tombstoned as well.
+func (r *Repository[T]) Tombstone(ctx context.Context, agg T) error {
+	return r.delete(ctx, agg, true)
+}
+
+func (r *Repository[T]) delete(ctx context.Context, agg T, tombstone bool) error {
+	err := r.Save(ctx, agg)
+
+	if err != nil {
+		return err
+	}
+
+	if agg.OriginalVersion() == NoStreamRevision {
+		return fmt.Errorf("%w: %s %s", ErrAggregateNotFound, r.aggregateType, agg.AggregateID())
+	}
+
+	streamName, err := r.StreamName(agg.AggregateID())
+
+	if err != nil {
+		return err
+	}
+
+	// The snapshot goes first, so failing to delete it leaves the aggregate
+	// as it was rather than a snapshot of a deleted aggregate, which would be
+	// restored if the stream is appended to again.
+	if err := r.deleteSnapshot(ctx, agg.AggregateID(), tombstone); err != nil {
+		return err
+	}
+
+	if tombstone {
+		return r.store.TombstoneStream(ctx, streamName.String(), ExpectedRevisionFor(agg))
+	}
+
+	return r.store.DeleteStream(ctx, streamName.String(), ExpectedRevisionFor(agg))
+}
+
+func (r *Repository[T]) deleteSnapshot(ctx context.Context, aggregateID string, tombstone bool) error {
+	if r.config.SnapshotStore == nil {
+		return nil
+	}
+
+	if tombstoner, ok := r.config.SnapshotStore.(SnapshotTombstoner); ok && tombstone {
+		return tombstoner.TombstoneSnapshot(ctx, r.aggregateType, aggregateID)
+	}
+
+	return r.config.SnapshotStore.DeleteSnapshot(ctx, r.aggregateType, aggregateID)
+}
+
+// loadSnapshot loads the latest snapshot of the aggregate, decrypting its
+// personal data. Snapshots that cannot be decrypted are ignored, so the
+// aggregate is rebuilt from its events.
+func (r *Repository[T]) loadSnapshot(ctx context.Context, aggregateID string) (*Snapshot, error) {
+	if r.config.SnapshotStore == nil {
+		return nil, nil
+	}
+
+	snapshot, err := r.config.SnapshotStore.LoadSnapshot(ctx, r.aggregateType, aggregateID)
+
+	if err != nil || snapshot == nil {
+		return snapshot, err
+	}
+
+	snapshotter, ok := Aggregate(r.factory(aggregateID)).(PersonalDataSnapshotter)
+	encryption := personalDataEncryptionOf(r.store)
+
+	if !ok || encryption == nil {
+		return snapshot, nil
+	}
+
+	snapshot.State, err = encryption.decryptState(ctx, snapshot.State, snapshotter.NewSnapshotState(), aggregateID)
+
+	if err != nil {
+		log.Printf("ignoring snapshot of %s %s: %v", r.aggregateType, aggregateID, err)
+
+		return nil, nil
+	}
+
+	return snapshot, nil
+}
+
+// saveSnapshot stores a snapshot of the aggregate when the snapshot policy asks
+// for one. The events are already committed at this point, so failures are
+// only logged and the next load replays the stream from the previous snapshot.
+func (r *Repository[T]) saveSnapshot(ctx context.Context, agg T, committed []Event) {
+	if r.config.SnapshotStore == nil || r.config.SnapshotPolicy == nil || !r.config.SnapshotPolicy(agg, committed) {
+		return
+	}
+
+	snapshot, err := TakeSnapshot(agg)
+
+	snapshotter, ok := Aggregate(agg).(PersonalDataSnapshotter)
+	encryption := personalDataEncryptionOf(r.store)
+
+	if err == nil && ok && encryption != nil {
+		snapshot.State, err = encryption.encryptState(ctx, snapshot.State, snapshotter.NewSnapshotState(), agg.AggregateID())
+	}
+
+	if err == nil {
+		err = r.config.SnapshotStore.SaveSnapshot(ctx, snapshot)
+	}
+
+	if err != nil {
+		log.Printf("error when saving snapshot of %s %s: %v", r.aggregateType, agg.AggregateID(), err)
+	}
+}
+
+// setStreamMetadata applies the stream metadata policy to the aggregate stream
+// and its snapshot stream, so snapshots expire along with the events. Like
+// snapshots, failures are only logged as the events are already committed.
+func (r *Repository[T]) setStreamMetadata(ctx context.Context, streamName StreamName, agg T, committed []Event) {
+	if r.config.StreamMetadata == nil {
+		return
+	}
+
+	metadata := r.config.StreamMetadata(agg, committed)
+
+	if metadata == nil {
+		return
+	}
+
+	err := r.store.SetStreamMetadata(ctx, streamName.String(), *metadata)
+
+	if errors.Is(err, ErrStreamMetadataNotSupported) {
+		return
+	}
+
+	if err == nil {
+		if snapshotStore, ok := r.config.SnapshotStore.(SnapshotStreamMetadataSetter); ok {
+			err = snapshotStore.SetSnapshotStreamMetadata(ctx, r.aggregateType, agg.AggregateID(), *metadata)
+		}
+	}
+
+	if err != nil && !errors.Is(err, ErrStreamMetadataNotSupported) {
+		log.Printf("error when setting stream metadata of %s %s: %v", r.aggregateType, agg.AggregateID(), err)
+	}
+}
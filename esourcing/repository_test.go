@@ -0,0 +1,363 @@
+package esourcing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// readRecordingStore records the stream reads and the stream metadata set,
+// and reads streams without events while empty is set, like EventStoreDB once
+// their events expired.
+type readRecordingStore struct {
+	EventStore
+	reads    []ReadStreamOptions
+	empty    bool
+	metadata map[string][]StreamMetadata
+}
+
+func (s *readRecordingStore) ReadStream(ctx context.Context, streamID string, options ReadStreamOptions, count uint64) ([]Event, error) {
+	s.reads = append(s.reads, options)
+
+	if s.empty {
+		return nil, nil
+	}
+
+	return s.EventStore.ReadStream(ctx, streamID, options, count)
+}
+
+func (s *readRecordingStore) GetStreamMetadata(ctx context.Context, streamID string) (*StreamMetadata, error) {
+	metadata := s.metadata[streamID]
+
+	if len(metadata) == 0 {
+		return &StreamMetadata{}, nil
+	}
+
+	return &metadata[len(metadata)-1], nil
+}
+
+func (s *readRecordingStore) SetStreamMetadata(ctx context.Context, streamID string, metadata StreamMetadata) error {
+	if s.metadata == nil {
+		s.metadata = map[string][]StreamMetadata{}
+	}
+
+	s.metadata[streamID] = append(s.metadata[streamID], metadata)
+
+	return nil
+}
+
+func newCounterRepository(t *testing.T, config RepositoryConfig) (*Repository[*counter], *readRecordingStore) {
+	t.Helper()
+
+	store := &readRecordingStore{EventStore: NewInMemoryEventStore()}
+	registerCounterEvents(t, store)
+
+	return NewRepository(store, counterAggregateType, newCounter, config), store
+}
+
+func newSnapshotConfig(t *testing.T, store EventStore, policy SnapshotPolicy) RepositoryConfig {
+	t.Helper()
+
+	snapshotStore, err := NewEventStoreSnapshotStore(store, StreamNaming{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return RepositoryConfig{SnapshotStore: snapshotStore, SnapshotPolicy: policy}
+}
+
+func saveIncrements(t *testing.T, repository *Repository[*counter], c *counter, by ...int) {
+	t.Helper()
+
+	for _, value := range by {
+		c.Increment(context.Background(), value)
+	}
+
+	if err := repository.Save(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepositoryLoadsFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	sharedStore := NewInMemoryEventStore()
+	registerCounterEvents(t, sharedStore)
+
+	store := &readRecordingStore{EventStore: sharedStore}
+	repository := NewRepository(store, counterAggregateType, newCounter, newSnapshotConfig(t, sharedStore, SnapshotEvery(3)))
+
+	c := newCounter("1")
+	saveIncrements(t, repository, c, 1, 2, 3)
+
+	store.reads = nil
+
+	loaded, err := repository.Load(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.value != 6 || loaded.StreamRevision() != 2 {
+		t.Fatalf("expected value 6 at revision 2, got %d at %d", loaded.value, loaded.StreamRevision())
+	}
+
+	if len(store.reads) != 1 || store.reads[0].From != Revision(2) {
+		t.Fatalf("expected a single read from the snapshot revision, got %+v", store.reads)
+	}
+}
+
+func TestRepositoryLoadReadsEventsAfterSnapshot(t *testing.T) {
+	ctx := context.Background()
+	sharedStore := NewInMemoryEventStore()
+	registerCounterEvents(t, sharedStore)
+
+	store := &readRecordingStore{EventStore: sharedStore}
+	repository := NewRepository(store, counterAggregateType, newCounter, newSnapshotConfig(t, sharedStore, SnapshotEvery(2)))
+
+	c := newCounter("1")
+	saveIncrements(t, repository, c, 1, 2)
+	saveIncrements(t, repository, c, 10)
+
+	store.reads = nil
+
+	loaded, err := repository.Load(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.value != 13 || loaded.StreamRevision() != 2 || loaded.Version() != 2 {
+		t.Fatalf("expected value 13 at revision 2, got %d at %d", loaded.value, loaded.StreamRevision())
+	}
+
+	if store.reads[0].From != Revision(1) {
+		t.Fatalf("expected to read from revision 1, the snapshot revision, got %+v", store.reads[0].From)
+	}
+
+	saveIncrements(t, repository, loaded, 100)
+	store.reads = nil
+
+	reloaded, err := repository.Load(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded.value != 113 || reloaded.StreamRevision() != 3 {
+		t.Fatalf("expected value 113 at revision 3 after saving the loaded counter, got %d at %d", reloaded.value, reloaded.StreamRevision())
+	}
+
+	if store.reads[0].From != Revision(3) {
+		t.Fatalf("expected to read from revision 3, the new snapshot revision, got %+v", store.reads[0].From)
+	}
+}
+
+func TestRepositoryLoadWithoutEvents(t *testing.T) {
+	ctx := context.Background()
+	repository, store := newCounterRepository(t, RepositoryConfig{})
+
+	_, err := repository.Load(ctx, "missing")
+
+	if !errors.Is(err, ErrAggregateNotFound) {
+		t.Fatalf("expected aggregate not found for a missing stream, got %v", err)
+	}
+
+	saveIncrements(t, repository, newCounter("1"), 1)
+
+	store.empty = true
+
+	loaded, err := repository.Load(ctx, "1")
+
+	if !errors.Is(err, ErrAggregateNotFound) {
+		t.Fatalf("expected aggregate not found for a stream without events, got %v and %+v", err, loaded)
+	}
+
+	if exists, err := repository.Exists(ctx, "1"); err != nil || exists {
+		t.Fatalf("expected a stream without events not to exist, got %v, %v", exists, err)
+	}
+}
+
+func TestRepositorySaveCommitsEvents(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := newCounterRepository(t, RepositoryConfig{})
+
+	c := newCounter("1")
+	saveIncrements(t, repository, c, 1, 2)
+	saveIncrements(t, repository, c, 3)
+
+	if len(c.UncommittedEvents()) != 0 || len(c.Events()) != 3 || c.StreamRevision() != 2 {
+		t.Fatalf("expected 3 committed events at revision 2, got %d uncommitted, %d committed at revision %d", len(c.UncommittedEvents()), len(c.Events()), c.StreamRevision())
+	}
+
+	if exists, err := repository.Exists(ctx, "1"); err != nil || !exists {
+		t.Fatalf("expected the aggregate to exist, got %v, %v", exists, err)
+	}
+}
+
+// snapshotStores returns a stream-backed and a SQL snapshot store, the first
+// keeping snapshots in store.
+func snapshotStores(t *testing.T, store EventStore) map[string]SnapshotStore {
+	t.Helper()
+
+	eventStoreSnapshotStore, err := NewEventStoreSnapshotStore(store, StreamNaming{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newSQLiteDB(t)
+
+	if err := CreateSQLSnapshotStoreSchema(db, SQLiteDialect); err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]SnapshotStore{
+		"eventstore": eventStoreSnapshotStore,
+		"sql":        NewSQLSnapshotStore(db, SQLiteDialect),
+	}
+}
+
+func TestRepositoryTombstoneDeletesSnapshot(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryEventStore()
+	registerCounterEvents(t, store)
+
+	for name, snapshotStore := range snapshotStores(t, store) {
+		t.Run(name, func(t *testing.T) {
+			repository := NewRepository(store, counterAggregateType, newCounter, RepositoryConfig{SnapshotStore: snapshotStore, SnapshotPolicy: SnapshotEvery(1)})
+
+			c := newCounter(name)
+			saveIncrements(t, repository, c, 1, 2)
+
+			if err := repository.Tombstone(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := repository.Load(ctx, name); !errors.Is(err, ErrAggregateNotFound) {
+				t.Fatalf("expected aggregate not found after a purge, got %v", err)
+			}
+
+			if exists, err := repository.Exists(ctx, name); err != nil || exists {
+				t.Fatalf("expected a purged aggregate not to exist, got %v, %v", exists, err)
+			}
+
+			if snapshot, err := snapshotStore.LoadSnapshot(ctx, counterAggregateType, name); err != nil || snapshot != nil {
+				t.Fatalf("expected no snapshot after a purge, got %+v, %v", snapshot, err)
+			}
+		})
+	}
+}
+
+func TestRepositoryDeleteDeletesSnapshot(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryEventStore()
+	registerCounterEvents(t, store)
+
+	for name, snapshotStore := range snapshotStores(t, store) {
+		t.Run(name, func(t *testing.T) {
+			repository := NewRepository(store, counterAggregateType, newCounter, RepositoryConfig{SnapshotStore: snapshotStore, SnapshotPolicy: SnapshotEvery(2)})
+
+			c := newCounter(name)
+			saveIncrements(t, repository, c, 1, 2)
+
+			if err := repository.Delete(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+
+			if snapshot, err := snapshotStore.LoadSnapshot(ctx, counterAggregateType, name); err != nil || snapshot != nil {
+				t.Fatalf("expected no snapshot after a delete, got %+v, %v", snapshot, err)
+			}
+
+			// Appending again brings the aggregate back without the deleted state.
+			saveIncrements(t, repository, newCounter(name), 10)
+
+			loaded, err := repository.Load(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if loaded.value != 10 {
+				t.Fatalf("expected value 10 after the delete, got %d", loaded.value)
+			}
+		})
+	}
+}
+
+func TestRepositoryLoadIgnoresSnapshotOfExpiredStream(t *testing.T) {
+	ctx := context.Background()
+	sharedStore := NewInMemoryEventStore()
+	registerCounterEvents(t, sharedStore)
+
+	store := &readRecordingStore{EventStore: sharedStore}
+	repository := NewRepository(store, counterAggregateType, newCounter, newSnapshotConfig(t, sharedStore, SnapshotEvery(1)))
+
+	saveIncrements(t, repository, newCounter("1"), 1, 2)
+
+	store.empty = true
+
+	loaded, err := repository.Load(ctx, "1")
+
+	if !errors.Is(err, ErrAggregateNotFound) {
+		t.Fatalf("expected aggregate not found once the events expired, got %v and %+v", err, loaded)
+	}
+}
+
+func TestStreamMaxAgeUntil(t *testing.T) {
+	sharedStore := NewInMemoryEventStore()
+	registerCounterEvents(t, sharedStore)
+
+	store := &readRecordingStore{EventStore: sharedStore}
+	config := newSnapshotConfig(t, store, SnapshotEvery(1))
+	config.StreamMetadata = StreamMaxAgeUntil(time.Hour, "counterReset")
+	repository := NewRepository(store, counterAggregateType, newCounter, config)
+
+	c := newCounter("1")
+	saveIncrements(t, repository, c, 1)
+	saveIncrements(t, repository, c, 2)
+
+	expected := map[string][]StreamMetadata{
+		"counter#1":          {{MaxAge: time.Hour}},
+		"counter_snapshot#1": {{MaxAge: time.Hour, MaxCount: 1}},
+	}
+
+	for streamID, metadata := range expected {
+		if !reflect.DeepEqual(store.metadata[streamID], metadata) {
+			t.Fatalf("expected %s to expire once created, got %+v", streamID, store.metadata[streamID])
+		}
+	}
+
+	config.StreamMetadata = StreamMaxAgeUntil(time.Hour, incrementEvents("2", 1)[0].EventType())
+	repository = NewRepository(store, counterAggregateType, newCounter, config)
+
+	saveIncrements(t, repository, newCounter("2"), 1)
+
+	if !reflect.DeepEqual(store.metadata["counter#2"], []StreamMetadata{{}}) {
+		t.Fatalf("expected the stream to stop expiring, got %+v", store.metadata["counter#2"])
+	}
+}
+
+func TestEventStoreSnapshotStoreKeepsLatestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	store := &readRecordingStore{EventStore: NewInMemoryEventStore()}
+
+	snapshotStore, err := NewEventStoreSnapshotStore(store, StreamNaming{Separator: "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for revision := int64(0); revision < 3; revision++ {
+		snapshot := Snapshot{AggregateType: counterAggregateType, AggregateID: "1", Revision: revision, State: []byte("{}"), CreatedAt: time.Now()}
+
+		if err := snapshotStore.SaveSnapshot(ctx, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(store.metadata["counter_snapshot-1"], []StreamMetadata{{MaxCount: 1}}) {
+		t.Fatalf("expected the snapshot stream to keep one snapshot once created, got %+v", store.metadata)
+	}
+
+	snapshot, err := snapshotStore.LoadSnapshot(ctx, counterAggregateType, "1")
+
+	if err != nil || snapshot == nil || snapshot.Revision != 2 {
+		t.Fatalf("expected the latest snapshot, got %+v, %v", snapshot, err)
+	}
+}
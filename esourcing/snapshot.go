@@ -0,0 +1,279 @@
+package esourcing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Snapshot is the serialized state of an aggregate right after the event at
+// Revision was applied.
+type Snapshot struct {
+	AggregateType AggregateType
+	AggregateID   string
+	Revision      int64
+	State         []byte
+	CreatedAt     time.Time
+}
+
+// SnapshotPolicy decides whether a snapshot should be taken after the given
+// events were committed to the aggregate stream.
+type SnapshotPolicy func(agg Aggregate, committed []Event) bool
+
+// SnapshotEvery takes a snapshot each time the stream crosses a multiple of n events.
+func SnapshotEvery(n int64) SnapshotPolicy {
+	return func(agg Aggregate, committed []Event) bool {
+		before := agg.StreamRevision() + 1 - int64(len(committed))
+		after := agg.StreamRevision() + 1
+
+		return n > 0 && before/n != after/n
+	}
+}
+
+// SnapshotOn takes a snapshot whenever one of the given event types is committed.
+func SnapshotOn(eventTypes ...string) SnapshotPolicy {
+	return func(agg Aggregate, committed []Event) bool {
+		return committedAny(committed, eventTypes)
+	}
+}
+
+func committedAny(committed []Event, eventTypes []string) bool {
+	for _, event := range committed {
+		for _, eventType := range eventTypes {
+			if event.EventType() == eventType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// AnySnapshotPolicy takes a snapshot when at least one of the policies does.
+func AnySnapshotPolicy(policies ...SnapshotPolicy) SnapshotPolicy {
+	return func(agg Aggregate, committed []Event) bool {
+		for _, policy := range policies {
+			if policy(agg, committed) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// TakeSnapshot serializes the aggregate at its current stream revision. The
+// aggregate must implement Snapshotter.
+func TakeSnapshot(agg Aggregate) (Snapshot, error) {
+	snapshotter, ok := agg.(Snapshotter)
+
+	if !ok {
+		return Snapshot{}, fmt.Errorf("aggregate %s does not implement Snapshotter", agg.AggregateType())
+	}
+
+	state, err := snapshotter.Snapshot()
+
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error when taking snapshot of %s %s: %w", agg.AggregateType(), agg.AggregateID(), err)
+	}
+
+	return Snapshot{
+		AggregateType: agg.AggregateType(),
+		AggregateID:   agg.AggregateID(),
+		Revision:      agg.StreamRevision(),
+		State:         state,
+		CreatedAt:     time.Now().UTC(),
+	}, nil
+}
+
+// RebuildFromSnapshot restores the aggregate state from the snapshot and
+// applies the events that were appended after it.
+func RebuildFromSnapshot(a Aggregate, snapshot *Snapshot, events []Event) error {
+	snapshotter, ok := a.(Snapshotter)
+
+	if !ok {
+		return fmt.Errorf("aggregate %s does not implement Snapshotter", a.AggregateType())
+	}
+
+	if err := snapshotter.RestoreSnapshot(snapshot.State); err != nil {
+		return fmt.Errorf("error when restoring snapshot of %s %s: %w", snapshot.AggregateType, snapshot.AggregateID, err)
+	}
+
+	a.SetEvents(events)
+	a.SetStreamRevision(lastRevision(events, snapshot.Revision))
+
+	for _, e := range events {
+		if err := applyEvent(a, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SnapshotTaken is the event the stream-backed snapshot store appends to the
+// snapshot stream of an aggregate.
+type SnapshotTaken struct {
+	EventBase
+	Revision int64  `json:"revision"`
+	State    []byte `json:"state"`
+}
+
+func (e SnapshotTaken) Version() string {
+	return "v1"
+}
+
+type eventStoreSnapshotStore struct {
+	store  EventStore
+	naming StreamNaming
+}
+
+// NewEventStoreSnapshotStore returns a SnapshotStore that keeps snapshots as
+// SnapshotTaken events in a dedicated "<type>_snapshot" stream per aggregate,
+// named like the aggregate streams with naming. Only the latest snapshot is
+// kept, stores without stream metadata support keep them all.
+func NewEventStoreSnapshotStore(store EventStore, naming StreamNaming) (SnapshotStore, error) {
+	if err := store.RegisterEventType((*SnapshotTaken)(nil), "SnapshotTaken"); err != nil {
+		return nil, err
+	}
+
+	return &eventStoreSnapshotStore{
+		store:  store,
+		naming: naming,
+	}, nil
+}
+
+func (s *eventStoreSnapshotStore) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	event := SnapshotTaken{
+		EventBase: NewEventBaseForAggregate(snapshot.AggregateType, snapshot.AggregateID, "SnapshotTaken", snapshot.CreatedAt),
+		Revision:  snapshot.Revision,
+		State:     snapshot.State,
+	}
+	event.metadata = eventMetadataFor(ctx, event.eventID)
+
+	streamName, err := s.streamName(snapshot.AggregateType, snapshot.AggregateID)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := s.store.AppendToStream(ctx, streamName.String(), Any{}, []Event{event})
+
+	if err != nil {
+		return err
+	}
+
+	// Snapshots are appended whatever the stream revision, so the stream would
+	// otherwise grow with every snapshot.
+	if result.NextExpectedRevision == 0 {
+		err = s.keepLatestSnapshot(ctx, streamName)
+	}
+
+	if errors.Is(err, ErrStreamMetadataNotSupported) {
+		return nil
+	}
+
+	return err
+}
+
+// keepLatestSnapshot sets $maxCount to 1 on the snapshot stream, keeping the
+// metadata the repository may have set on it before.
+func (s *eventStoreSnapshotStore) keepLatestSnapshot(ctx context.Context, streamName StreamName) error {
+	metadata, err := s.store.GetStreamMetadata(ctx, streamName.String())
+
+	if err != nil {
+		return err
+	}
+
+	if metadata.MaxCount == 1 {
+		return nil
+	}
+
+	metadata.MaxCount = 1
+
+	return s.store.SetStreamMetadata(ctx, streamName.String(), *metadata)
+}
+
+func (s *eventStoreSnapshotStore) LoadSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) (*Snapshot, error) {
+	streamName, err := s.streamName(aggregateType, aggregateID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := s.store.ReadLastEventFromStream(ctx, streamName.String())
+
+	var streamDeletedError *StreamDeletedError
+
+	if errors.Is(err, ErrStreamNotFound) || errors.As(err, &streamDeletedError) || event == nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotTaken, ok := event.(SnapshotTaken)
+
+	if !ok {
+		return nil, fmt.Errorf("unexpected event %s in snapshot stream of %s %s", event.EventType(), aggregateType, aggregateID)
+	}
+
+	return &Snapshot{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Revision:      snapshotTaken.Revision,
+		State:         snapshotTaken.State,
+		CreatedAt:     snapshotTaken.Timestamp(),
+	}, nil
+}
+
+// DeleteSnapshot soft-deletes the snapshot stream of the aggregate, so it can
+// be snapshotted again if its stream is appended to again.
+func (s *eventStoreSnapshotStore) DeleteSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) error {
+	streamName, err := s.streamName(aggregateType, aggregateID)
+
+	if err != nil {
+		return err
+	}
+
+	return s.store.DeleteStream(ctx, streamName.String(), Any{})
+}
+
+// TombstoneSnapshot tombstones the snapshot stream of the aggregate.
+func (s *eventStoreSnapshotStore) TombstoneSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) error {
+	streamName, err := s.streamName(aggregateType, aggregateID)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.store.TombstoneStream(ctx, streamName.String(), Any{})
+
+	var streamDeletedError *StreamDeletedError
+
+	if errors.As(err, &streamDeletedError) {
+		return nil
+	}
+
+	return err
+}
+
+// SetSnapshotStreamMetadata sets the metadata of the snapshot stream of the
+// aggregate, still keeping only its latest snapshot.
+func (s *eventStoreSnapshotStore) SetSnapshotStreamMetadata(ctx context.Context, aggregateType AggregateType, aggregateID string, metadata StreamMetadata) error {
+	streamName, err := s.streamName(aggregateType, aggregateID)
+
+	if err != nil {
+		return err
+	}
+
+	metadata.MaxCount = 1
+
+	return s.store.SetStreamMetadata(ctx, streamName.String(), metadata)
+}
+
+func (s *eventStoreSnapshotStore) streamName(aggregateType AggregateType, aggregateID string) (StreamName, error) {
+	return s.naming.New(string(aggregateType)+"_snapshot", aggregateID)
+}
@@ -0,0 +1,825 @@
+package esourcing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SQLDialect holds the statements that differ between the databases supported
+// by the SQL event store.
+type SQLDialect struct {
+	name            string
+	schema          []string
+	positionSchema  []string
+	lockAppends     string
+	deleteStream    string
+	snapshotSchema  string
+	saveSnapshot    string
+	keyStoreSchema  string
+	forgottenSchema string
+}
+
+var MySQLDialect = SQLDialect{
+	name: "mysql",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS es_event (
+			global_position BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			event_id VARCHAR(36) NOT NULL,
+			stream_id VARCHAR(255) NOT NULL,
+			stream_revision BIGINT UNSIGNED NOT NULL,
+			event_type VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			data LONGBLOB NOT NULL,
+			metadata LONGBLOB NOT NULL,
+			created_at BIGINT NOT NULL,
+			UNIQUE KEY es_event_event_id (event_id),
+			UNIQUE KEY es_event_stream_revision (stream_id, stream_revision)
+		);`,
+		`CREATE TABLE IF NOT EXISTS es_stream (
+			stream_id VARCHAR(255) PRIMARY KEY,
+			truncate_before BIGINT UNSIGNED NOT NULL DEFAULT 0
+		);`,
+	},
+	positionSchema: []string{
+		`CREATE TABLE IF NOT EXISTS es_position (
+			id INT PRIMARY KEY,
+			last_position BIGINT UNSIGNED NOT NULL
+		);`,
+		`INSERT IGNORE INTO es_position (id, last_position)
+			SELECT 1, COALESCE(MAX(global_position), 0) FROM es_event;`,
+	},
+	deleteStream: `INSERT INTO es_stream (stream_id, truncate_before) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE truncate_before = VALUES(truncate_before);`,
+	snapshotSchema: `CREATE TABLE IF NOT EXISTS es_snapshot (
+		aggregate_type VARCHAR(255) NOT NULL,
+		aggregate_id VARCHAR(255) NOT NULL,
+		stream_revision BIGINT NOT NULL,
+		state LONGBLOB NOT NULL,
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (aggregate_type, aggregate_id)
+	);`,
+	saveSnapshot: `INSERT INTO es_snapshot (aggregate_type, aggregate_id, stream_revision, state, created_at) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE stream_revision = VALUES(stream_revision), state = VALUES(state), created_at = VALUES(created_at);`,
+	keyStoreSchema: `CREATE TABLE IF NOT EXISTS es_subject_key (
+		subject_id VARCHAR(255) PRIMARY KEY,
+		encryption_key VARBINARY(32) NOT NULL,
+		created_at BIGINT NOT NULL
+	);`,
+	forgottenSchema: `CREATE TABLE IF NOT EXISTS es_forgotten_subject (
+		subject_id VARCHAR(255) PRIMARY KEY,
+		forgotten_at BIGINT NOT NULL
+	);`,
+}
+
+var SQLiteDialect = SQLDialect{
+	name: "sqlite",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS es_event (
+			global_position INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_id TEXT NOT NULL UNIQUE,
+			stream_id TEXT NOT NULL,
+			stream_revision INTEGER NOT NULL,
+			event_type TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			data BLOB NOT NULL,
+			metadata BLOB NOT NULL,
+			created_at INTEGER NOT NULL,
+			UNIQUE (stream_id, stream_revision)
+		);`,
+		`CREATE TABLE IF NOT EXISTS es_stream (
+			stream_id TEXT PRIMARY KEY,
+			truncate_before INTEGER NOT NULL DEFAULT 0
+		);`,
+	},
+	positionSchema: []string{
+		`CREATE TABLE IF NOT EXISTS es_position (
+			id INTEGER PRIMARY KEY,
+			last_position INTEGER NOT NULL
+		);`,
+		`INSERT OR IGNORE INTO es_position (id, last_position)
+			SELECT 1, COALESCE(MAX(global_position), 0) FROM es_event;`,
+	},
+	// SQLite has a single writer. Writing first takes the database write
+	// lock up front, instead of upgrading a read lock, which fails when
+	// another append holds it.
+	lockAppends: `UPDATE es_position SET id = id WHERE id = 1;`,
+	deleteStream: `INSERT INTO es_stream (stream_id, truncate_before) VALUES (?, ?)
+		ON CONFLICT (stream_id) DO UPDATE SET truncate_before = excluded.truncate_before;`,
+	snapshotSchema: `CREATE TABLE IF NOT EXISTS es_snapshot (
+		aggregate_type TEXT NOT NULL,
+		aggregate_id TEXT NOT NULL,
+		stream_revision INTEGER NOT NULL,
+		state BLOB NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (aggregate_type, aggregate_id)
+	);`,
+	saveSnapshot: `INSERT INTO es_snapshot (aggregate_type, aggregate_id, stream_revision, state, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (aggregate_type, aggregate_id) DO UPDATE SET stream_revision = excluded.stream_revision, state = excluded.state, created_at = excluded.created_at;`,
+	keyStoreSchema: `CREATE TABLE IF NOT EXISTS es_subject_key (
+		subject_id TEXT PRIMARY KEY,
+		encryption_key BLOB NOT NULL,
+		created_at INTEGER NOT NULL
+	);`,
+	forgottenSchema: `CREATE TABLE IF NOT EXISTS es_forgotten_subject (
+		subject_id TEXT PRIMARY KEY,
+		forgotten_at INTEGER NOT NULL
+	);`,
+}
+
+func (d SQLDialect) String() string {
+	return d.name
+}
+
+// EventStoreSchema returns the statements creating the tables of the SQL event
+// store, for schema migrations. They do not fail when the tables exist.
+func (d SQLDialect) EventStoreSchema() []string {
+	return d.schema
+}
+
+// PositionSchema returns the statements creating the es_position row global
+// positions are handed out from, starting after the last stored event.
+func (d SQLDialect) PositionSchema() []string {
+	return d.positionSchema
+}
+
+// SnapshotStoreSchema returns the statements creating the table of the SQL
+// snapshot store.
+func (d SQLDialect) SnapshotStoreSchema() []string {
+	return []string{d.snapshotSchema}
+}
+
+// KeyStoreSchema returns the statements creating the table of the SQL key
+// store.
+func (d SQLDialect) KeyStoreSchema() []string {
+	return []string{d.keyStoreSchema}
+}
+
+// ForgottenSubjectSchema returns the statements creating the table where the
+// SQL key store records forgotten subjects.
+func (d SQLDialect) ForgottenSubjectSchema() []string {
+	return []string{d.forgottenSchema}
+}
+
+// sqlTombstoneRevision is the truncate_before mark of a tombstoned stream.
+const sqlTombstoneRevision uint64 = math.MaxInt64
+
+const sqlEventColumns = "global_position, event_id, stream_id, stream_revision, event_type, content_type, data, metadata, created_at"
+
+type SQLEventStoreConfig struct {
+	// PollInterval is how long subscriptions wait before querying for new
+	// events once they have caught up.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of events a subscription fetches per query.
+	BatchSize int
+}
+
+type sqlEventStore struct {
+	db                *sql.DB
+	dialect           SQLDialect
+	config            SQLEventStoreConfig
+	eventTypeRegistry *EventTypeRegistry
+	eventMarshaller   EventMarshaller
+}
+
+// NewSQLEventStore returns an EventStore that keeps events in an append-only
+// es_event table. Every event gets a per-stream revision and a global position,
+// and the unique (stream_id, stream_revision) key rejects concurrent appends.
+//
+// Subscriptions poll the table by global position. Appends to different
+// streams run concurrently and only queue for the es_position row, which
+// hands out positions and stays locked until the append commits. Positions
+// are thus committed in increasing order, and a subscription never reads past
+// an event that is not committed yet.
+func NewSQLEventStore(db *sql.DB, dialect SQLDialect, config SQLEventStoreConfig) EventStore {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 500 * time.Millisecond
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+
+	eventTypeRegistry := NewEventTypeRegistry()
+
+	return &sqlEventStore{
+		db:                db,
+		dialect:           dialect,
+		config:            config,
+		eventTypeRegistry: eventTypeRegistry,
+		eventMarshaller:   NewEventMarshaller(eventTypeRegistry),
+	}
+}
+
+// CreateSQLEventStoreSchema creates the tables used by the SQL event store
+// when they do not exist yet.
+func CreateSQLEventStoreSchema(db *sql.DB, dialect SQLDialect) error {
+	for _, query := range append(dialect.schema, dialect.positionSchema...) {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("error creating %s event store schema: %w", dialect, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlEventStore) RegisterEventType(eventType EventType, name string, aliases ...string) error {
+	return s.eventTypeRegistry.Register(eventType, name, aliases...)
+}
+
+func (s *sqlEventStore) RegisteredEventTypes() []RegisteredEventType {
+	return s.eventTypeRegistry.RegisteredTypes()
+}
+
+func (s *sqlEventStore) ReadStream(ctx context.Context, streamID string, options ReadStreamOptions, count uint64) (events []Event, err error) {
+	truncateBefore, err := s.truncateBefore(ctx, s.db, streamID)
+
+	if err != nil {
+		return events, err
+	}
+
+	if truncateBefore == sqlTombstoneRevision {
+		return events, &StreamDeletedError{StreamID: streamID}
+	}
+
+	query := "SELECT " + sqlEventColumns + " FROM es_event WHERE stream_id = ? AND stream_revision >= ?"
+	args := []interface{}{streamID, truncateBefore}
+
+	switch from := options.From.(type) {
+	case StreamRevision:
+		if options.Direction == Backwards {
+			query += " AND stream_revision <= ?"
+		} else {
+			query += " AND stream_revision >= ?"
+		}
+		args = append(args, from.Value)
+	case End:
+		if options.Direction == Forwards {
+			return events, nil
+		}
+	}
+
+	if options.Direction == Backwards {
+		query += " ORDER BY stream_revision DESC LIMIT ?"
+	} else {
+		query += " ORDER BY stream_revision ASC LIMIT ?"
+	}
+	args = append(args, count)
+
+	recordedEvents, err := s.query(ctx, query, args...)
+
+	if err != nil {
+		return events, fmt.Errorf("error when reading stream %s: %w", streamID, err)
+	}
+
+	if len(recordedEvents) == 0 {
+		exists, err := s.streamExists(ctx, streamID, truncateBefore)
+
+		if err != nil {
+			return events, err
+		}
+
+		if !exists {
+			return events, ErrStreamNotFound
+		}
+	}
+
+	for _, recordedEvent := range recordedEvents {
+		event, err := s.eventMarshaller.FromRecordedEvent(ctx, recordedEvent)
+
+		if err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (s *sqlEventStore) ReadLastEventFromStream(ctx context.Context, streamID string) (Event, error) {
+	events, err := s.ReadStream(ctx, streamID, ReadStreamOptions{
+		From:      End{},
+		Direction: Backwards,
+	}, 1)
+
+	if err != nil {
+		return nil, fmt.Errorf("error when reading stream %s: %w", streamID, err)
+	}
+
+	if len(events) > 0 {
+		return events[0], nil
+	}
+
+	return nil, nil
+}
+
+func (s *sqlEventStore) ReadAll(ctx context.Context, options ReadAllOptions, count uint64) ([]ResolvedEvent, error) {
+	return readAll(ctx, s.eventMarshaller, options, count, s.readAllBatch)
+}
+
+func (s *sqlEventStore) readAllBatch(ctx context.Context, direction Direction, from AllPosition, batchSize uint64) ([]*RecordedEvent, bool, error) {
+	query := "SELECT " + sqlEventColumns + " FROM es_event WHERE global_position > ? ORDER BY global_position ASC LIMIT ?"
+	var position uint64
+
+	switch from := from.(type) {
+	case Position:
+		position = from.Commit
+	case End:
+		if direction == Forwards {
+			return nil, true, nil
+		}
+
+		position = math.MaxInt64
+	case Start:
+		if direction == Backwards {
+			return nil, true, nil
+		}
+	}
+
+	if direction == Backwards {
+		query = "SELECT " + sqlEventColumns + " FROM es_event WHERE global_position < ? ORDER BY global_position DESC LIMIT ?"
+	}
+
+	recordedEvents, err := s.query(ctx, query, position, batchSize)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error when reading all events: %w", err)
+	}
+
+	return recordedEvents, uint64(len(recordedEvents)) < batchSize, nil
+}
+
+func (s *sqlEventStore) AppendToStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision, events []Event) (*WriteResult, error) {
+	proposedEvents := make([]EventData, len(events))
+
+	for i, event := range events {
+		eventData, err := s.eventMarshaller.ToEventData(ctx, event)
+
+		if err != nil {
+			return nil, err
+		}
+
+		proposedEvents[i] = eventData
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if s.dialect.lockAppends != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.lockAppends); err != nil {
+			return nil, fmt.Errorf("error when appending to stream %s: %w", streamID, err)
+		}
+	}
+
+	var lastRevision sql.NullInt64
+
+	row := tx.QueryRowContext(ctx, "SELECT MAX(stream_revision) FROM es_event WHERE stream_id = ?", streamID)
+
+	if err := row.Scan(&lastRevision); err != nil {
+		return nil, fmt.Errorf("error when appending to stream %s: %w", streamID, err)
+	}
+
+	revision := NoStreamRevision
+
+	if lastRevision.Valid {
+		revision = lastRevision.Int64
+	}
+
+	truncateBefore, err := s.truncateBefore(ctx, tx, streamID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if truncateBefore == sqlTombstoneRevision {
+		return nil, &StreamDeletedError{StreamID: streamID}
+	}
+
+	exists := revision >= int64(truncateBefore)
+
+	if !acceptsExpectedRevision(expectedRevision, revision, exists) {
+		return nil, fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
+	}
+
+	// Concurrent appends to the stream are caught by the unique revision key
+	// below, so only the positions are handed out under a lock, held until
+	// commit, see NewSQLEventStore.
+	position, err := s.reservePositions(ctx, tx, len(proposedEvents))
+
+	if err != nil {
+		return nil, fmt.Errorf("error when appending to stream %s: %w", streamID, err)
+	}
+
+	firstPosition := position - int64(len(proposedEvents)) + 1
+	createdAt := time.Now().UTC().UnixNano()
+
+	for i, eventData := range proposedEvents {
+		revision++
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO es_event (global_position, event_id, stream_id, stream_revision, event_type, content_type, data, metadata, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);",
+			firstPosition+int64(i),
+			eventData.EventID,
+			streamID,
+			revision,
+			eventData.EventType,
+			string(eventData.ContentType),
+			eventData.Data,
+			eventData.Metadata,
+			createdAt,
+		)
+
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error when appending to stream %s: %w", streamID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
+		}
+
+		return nil, fmt.Errorf("error when appending to stream %s: %w", streamID, err)
+	}
+
+	return &WriteResult{
+		Position:             Position{Commit: uint64(position), Prepare: uint64(position)},
+		NextExpectedRevision: uint64(revision),
+	}, nil
+}
+
+// reservePositions moves the es_position row past count events and returns
+// the position of the last one. The row stays locked until the transaction
+// ends, and a rollback hands the positions out again.
+func (s *sqlEventStore) reservePositions(ctx context.Context, tx *sql.Tx, count int) (int64, error) {
+	var position int64
+
+	if count == 0 {
+		return position, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE es_position SET last_position = last_position + ? WHERE id = 1", count); err != nil {
+		return 0, err
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT last_position FROM es_position WHERE id = 1")
+
+	if err := row.Scan(&position); err != nil {
+		return 0, err
+	}
+
+	return position, nil
+}
+
+func (s *sqlEventStore) PersistentSubscribeToStream(ctx context.Context, streamName string, groupName string) (Subscription, error) {
+	return nil, ErrPersistentSubscriptionNotSupported
+}
+
+func (s *sqlEventStore) CreatePersistentSubscription(ctx context.Context, streamName string, groupName string, options PersistentSubscriptionOptions) error {
+	return ErrPersistentSubscriptionNotSupported
+}
+
+func (s *sqlEventStore) SubscribeToAll(ctx context.Context, options SubscribeToAllOptions) (Subscription, error) {
+	filter, err := newEventFilter(options.Filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var after uint64
+
+	switch from := options.From.(type) {
+	case Position:
+		after = from.Commit
+	case Start:
+		after = 0
+	default:
+		row := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(global_position), 0) FROM es_event")
+
+		if err := row.Scan(&after); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &sqlSubscription{
+		ctx:    ctx,
+		cancel: cancel,
+		store:  s,
+		query:  "SELECT " + sqlEventColumns + " FROM es_event WHERE global_position > ? ORDER BY global_position LIMIT ?",
+		after:  int64(after),
+		cursorOf: func(recordedEvent *RecordedEvent) int64 {
+			return int64(recordedEvent.Position.Commit)
+		},
+		filter: filter,
+	}, nil
+}
+
+func (s *sqlEventStore) SubscribeToStream(ctx context.Context, streamID string, options SubscribeToStreamOptions) (Subscription, error) {
+	var after int64
+
+	switch from := options.From.(type) {
+	case StreamRevision:
+		after = int64(from.Value)
+	case Start:
+		after = NoStreamRevision
+	default:
+		var lastRevision sql.NullInt64
+		row := s.db.QueryRowContext(ctx, "SELECT MAX(stream_revision) FROM es_event WHERE stream_id = ?", streamID)
+
+		if err := row.Scan(&lastRevision); err != nil {
+			return nil, err
+		}
+
+		after = NoStreamRevision
+
+		if lastRevision.Valid {
+			after = lastRevision.Int64
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &sqlSubscription{
+		ctx:    ctx,
+		cancel: cancel,
+		store:  s,
+		query:  "SELECT " + sqlEventColumns + " FROM es_event WHERE stream_id = ? AND stream_revision > ? ORDER BY stream_revision LIMIT ?",
+		args:   []interface{}{streamID},
+		after:  after,
+		cursorOf: func(recordedEvent *RecordedEvent) int64 {
+			return int64(recordedEvent.EventNumber)
+		},
+	}, nil
+}
+
+func (s *sqlEventStore) DeleteStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error {
+	return s.deleteStream(ctx, streamID, expectedRevision, false)
+}
+
+func (s *sqlEventStore) TombstoneStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision) error {
+	return s.deleteStream(ctx, streamID, expectedRevision, true)
+}
+
+// deleteStream moves the truncate_before mark of the stream past its last
+// event, or to sqlTombstoneRevision for a tombstone. The rows are kept, so
+// subscriptions still see every event.
+func (s *sqlEventStore) deleteStream(ctx context.Context, streamID string, expectedRevision ExpectedRevision, tombstone bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var lastRevision sql.NullInt64
+
+	row := tx.QueryRowContext(ctx, "SELECT MAX(stream_revision) FROM es_event WHERE stream_id = ?", streamID)
+
+	if err := row.Scan(&lastRevision); err != nil {
+		return fmt.Errorf("error when deleting stream %s: %w", streamID, err)
+	}
+
+	revision := NoStreamRevision
+
+	if lastRevision.Valid {
+		revision = lastRevision.Int64
+	}
+
+	truncateBefore, err := s.truncateBefore(ctx, tx, streamID)
+
+	if err != nil {
+		return err
+	}
+
+	if truncateBefore == sqlTombstoneRevision {
+		return &StreamDeletedError{StreamID: streamID}
+	}
+
+	if !acceptsExpectedRevision(expectedRevision, revision, revision >= int64(truncateBefore)) {
+		return fmt.Errorf("%w: stream %s was modified concurrently", ErrConcurrencyConflict, streamID)
+	}
+
+	if !lastRevision.Valid && !tombstone {
+		return nil
+	}
+
+	truncateBefore = uint64(revision + 1)
+
+	if tombstone {
+		truncateBefore = sqlTombstoneRevision
+	}
+
+	_, err = tx.ExecContext(ctx, s.dialect.deleteStream, streamID, truncateBefore)
+
+	if err != nil {
+		return fmt.Errorf("error when deleting stream %s: %w", streamID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error when deleting stream %s: %w", streamID, err)
+	}
+
+	return nil
+}
+
+func (s *sqlEventStore) GetStreamMetadata(ctx context.Context, streamID string) (*StreamMetadata, error) {
+	return nil, ErrStreamMetadataNotSupported
+}
+
+func (s *sqlEventStore) SetStreamMetadata(ctx context.Context, streamID string, metadata StreamMetadata) error {
+	return ErrStreamMetadataNotSupported
+}
+
+func (s *sqlEventStore) GetMarshaller() EventMarshaller {
+	return s.eventMarshaller
+}
+
+type sqlQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *sqlEventStore) truncateBefore(ctx context.Context, querier sqlQuerier, streamID string) (uint64, error) {
+	var truncateBefore uint64
+
+	row := querier.QueryRowContext(ctx, "SELECT truncate_before FROM es_stream WHERE stream_id = ?", streamID)
+	err := row.Scan(&truncateBefore)
+
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error when reading stream %s: %w", streamID, err)
+	}
+
+	return truncateBefore, nil
+}
+
+func (s *sqlEventStore) streamExists(ctx context.Context, streamID string, truncateBefore uint64) (bool, error) {
+	var count int
+
+	row := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM es_event WHERE stream_id = ? AND stream_revision >= ?", streamID, truncateBefore)
+
+	if err := row.Scan(&count); err != nil {
+		return false, fmt.Errorf("error when reading stream %s: %w", streamID, err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *sqlEventStore) query(ctx context.Context, query string, args ...interface{}) ([]*RecordedEvent, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var recordedEvents []*RecordedEvent
+
+	for rows.Next() {
+		var recordedEvent RecordedEvent
+		var position uint64
+		var contentType string
+		var createdAt int64
+
+		err := rows.Scan(
+			&position,
+			&recordedEvent.EventID,
+			&recordedEvent.StreamID,
+			&recordedEvent.EventNumber,
+			&recordedEvent.EventType,
+			&contentType,
+			&recordedEvent.Data,
+			&recordedEvent.Metadata,
+			&createdAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		recordedEvent.Position = Position{Commit: position, Prepare: position}
+		recordedEvent.ContentType = ContentType(contentType)
+		recordedEvent.CreatedDate = time.Unix(0, createdAt).UTC()
+
+		recordedEvents = append(recordedEvents, &recordedEvent)
+	}
+
+	return recordedEvents, rows.Err()
+}
+
+// Error codes of unique key violations.
+const (
+	mysqlDuplicateEntry        = 1062
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// isUniqueViolation reports whether err is a unique key violation of MySQL or
+// SQLite. SQLite errors are told by their extended result code, which the
+// modernc.org/sqlite driver exposes with a Code method, so the package does not
+// depend on a SQLite driver.
+func isUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+
+	var sqliteErr interface{ Code() int }
+
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqliteConstraintUnique || sqliteErr.Code() == sqliteConstraintPrimaryKey
+	}
+
+	return false
+}
+
+type sqlSubscription struct {
+	ctx      context.Context
+	store    *sqlEventStore
+	query    string
+	args     []interface{}
+	after    int64
+	cursorOf func(recordedEvent *RecordedEvent) int64
+	filter   *eventFilter
+	pending  []*RecordedEvent
+	cancel   context.CancelFunc
+}
+
+// Recv returns the next event, polling the es_event table until one is found.
+// When a filtered poll skips events without delivering any, a checkpoint at
+// the last skipped position is returned so callers can persist their progress.
+func (sub *sqlSubscription) Recv() *SubscriptionEvent {
+	for {
+		if len(sub.pending) > 0 {
+			recordedEvent := sub.pending[0]
+			sub.pending = sub.pending[1:]
+
+			return &SubscriptionEvent{EventAppeared: recordedEvent}
+		}
+
+		args := append(append([]interface{}{}, sub.args...), sub.after, sub.store.config.BatchSize)
+		recordedEvents, err := sub.store.query(sub.ctx, sub.query, args...)
+
+		if err != nil {
+			return sub.dropped(err)
+		}
+
+		var skipped *RecordedEvent
+
+		for _, recordedEvent := range recordedEvents {
+			sub.after = sub.cursorOf(recordedEvent)
+
+			if sub.filter != nil && !sub.filter.matches(recordedEvent) {
+				skipped = recordedEvent
+				continue
+			}
+
+			skipped = nil
+			sub.pending = append(sub.pending, recordedEvent)
+		}
+
+		if len(sub.pending) == 0 && skipped != nil {
+			return &SubscriptionEvent{CheckpointReached: &skipped.Position}
+		}
+
+		if len(recordedEvents) > 0 {
+			continue
+		}
+
+		select {
+		case <-time.After(sub.store.config.PollInterval):
+		case <-sub.ctx.Done():
+			return sub.dropped(sub.ctx.Err())
+		}
+	}
+}
+
+func (sub *sqlSubscription) Close() error {
+	sub.cancel()
+	return nil
+}
+
+func (sub *sqlSubscription) dropped(err error) *SubscriptionEvent {
+	return &SubscriptionEvent{
+		SubscriptionDropped: &SubscriptionDropped{
+			Error: err,
+		},
+	}
+}
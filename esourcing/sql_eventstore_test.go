@@ -0,0 +1,165 @@
+package esourcing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// newSQLiteDB opens an empty SQLite database in a temporary file, which unlike
+// an in-memory database is shared by every connection of the pool.
+func newSQLiteDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "events.db")+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+func newSQLiteEventStore(t testing.TB) EventStore {
+	t.Helper()
+
+	db := newSQLiteDB(t)
+
+	if err := CreateSQLEventStoreSchema(db, SQLiteDialect); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLEventStore(db, SQLiteDialect, SQLEventStoreConfig{PollInterval: 10 * time.Millisecond})
+}
+
+func TestSQLEventStore(t *testing.T) {
+	testEventStoreContract(t, func(t *testing.T) EventStore {
+		return newSQLiteEventStore(t)
+	})
+}
+
+func TestSQLEventStoreSubscriptionSeesConcurrentAppends(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newSQLiteEventStore(t)
+	registerCounterEvents(t, store)
+
+	subscription, err := store.SubscribeToAll(ctx, SubscribeToAllOptions{From: Start{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer subscription.Close()
+
+	const writers = 20
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+
+		go func(id string) {
+			defer wg.Done()
+
+			if _, err := store.AppendToStream(ctx, "counter#"+id, NoStream{}, incrementEvents(id, 1)); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprint(i))
+	}
+
+	var last uint64
+	streams := map[string]bool{}
+
+	for i := 0; i < writers; i++ {
+		recordedEvent := recvEvent(t, subscription)
+
+		if recordedEvent.Position.Commit <= last {
+			t.Fatalf("expected positions to increase, got %d after %d", recordedEvent.Position.Commit, last)
+		}
+
+		last = recordedEvent.Position.Commit
+		streams[recordedEvent.StreamID] = true
+	}
+
+	wg.Wait()
+
+	if len(streams) != writers {
+		t.Fatalf("expected events of %d streams, got %d", writers, len(streams))
+	}
+}
+
+func TestSQLEventStoreConflictingAppendLeavesNoPositionGap(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteEventStore(t)
+	registerCounterEvents(t, store)
+
+	first, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.AppendToStream(ctx, "counter#1", NoStream{}, incrementEvents("1", 3)); !errors.Is(err, ErrConcurrencyConflict) {
+		t.Fatalf("expected ErrConcurrencyConflict, got %v", err)
+	}
+
+	second, err := store.AppendToStream(ctx, "counter#2", NoStream{}, incrementEvents("2", 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Position.Commit != first.Position.Commit+1 {
+		t.Fatalf("expected position %d, got %d", first.Position.Commit+1, second.Position.Commit)
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	if _, err := db.Exec("CREATE TABLE unique_value (value INTEGER PRIMARY KEY, name TEXT UNIQUE)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO unique_value (value, name) VALUES (1, 'one')"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, duplicateKey := db.Exec("INSERT INTO unique_value (value, name) VALUES (1, 'other')")
+	_, duplicateValue := db.Exec("INSERT INTO unique_value (value, name) VALUES (2, 'one')")
+	_, notNull := db.Exec("CREATE TABLE required (value INTEGER NOT NULL); INSERT INTO required (value) VALUES (NULL)")
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"sqlite primary key", duplicateKey, true},
+		{"sqlite unique", duplicateValue, true},
+		{"sqlite not null", notNull, false},
+		{"mysql duplicate entry", fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1062}), true},
+		{"mysql foreign key", &mysql.MySQLError{Number: 1452}, false},
+		{"other", fmt.Errorf("Duplicate entry"), false},
+		{"nil", nil, false},
+	}
+
+	for _, c := range cases {
+		if c.err == nil && c.name != "nil" {
+			t.Fatalf("%s: expected an error", c.name)
+		}
+
+		if got := isUniqueViolation(c.err); got != c.want {
+			t.Errorf("%s: expected %v, got %v for %v", c.name, c.want, got, c.err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package esourcing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type sqlSnapshotStore struct {
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+// NewSQLSnapshotStore returns a SnapshotStore that keeps the latest snapshot
+// of each aggregate in the es_snapshot table.
+func NewSQLSnapshotStore(db *sql.DB, dialect SQLDialect) SnapshotStore {
+	return &sqlSnapshotStore{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// CreateSQLSnapshotStoreSchema creates the es_snapshot table when it does not
+// exist yet.
+func CreateSQLSnapshotStoreSchema(db *sql.DB, dialect SQLDialect) error {
+	if _, err := db.Exec(dialect.snapshotSchema); err != nil {
+		return fmt.Errorf("error creating %s snapshot store schema: %w", dialect, err)
+	}
+
+	return nil
+}
+
+func (s *sqlSnapshotStore) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.saveSnapshot,
+		snapshot.AggregateType.String(),
+		snapshot.AggregateID,
+		snapshot.Revision,
+		snapshot.State,
+		snapshot.CreatedAt.UnixNano(),
+	)
+
+	if err != nil {
+		return fmt.Errorf("error when saving snapshot of %s %s: %w", snapshot.AggregateType, snapshot.AggregateID, err)
+	}
+
+	return nil
+}
+
+func (s *sqlSnapshotStore) LoadSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+	}
+
+	var createdAt int64
+
+	row := s.db.QueryRowContext(ctx, "SELECT stream_revision, state, created_at FROM es_snapshot WHERE aggregate_type = ? AND aggregate_id = ?", aggregateType.String(), aggregateID)
+	err := row.Scan(&snapshot.Revision, &snapshot.State, &createdAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error when loading snapshot of %s %s: %w", aggregateType, aggregateID, err)
+	}
+
+	snapshot.CreatedAt = time.Unix(0, createdAt).UTC()
+
+	return snapshot, nil
+}
+
+func (s *sqlSnapshotStore) DeleteSnapshot(ctx context.Context, aggregateType AggregateType, aggregateID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM es_snapshot WHERE aggregate_type = ? AND aggregate_id = ?", aggregateType.String(), aggregateID)
+
+	if err != nil {
+		return fmt.Errorf("error when deleting snapshot of %s %s: %w", aggregateType, aggregateID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package esourcing
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidStreamName = fmt.Errorf("invalid stream name")
+
+// DefaultStreamSeparator separates the category from the ID in stream names.
+// EventStoreDB $ce- category projections split on "-" by default, use
+// StreamNaming{Separator: "-"} to benefit from them.
+const DefaultStreamSeparator = "#"
+
+// StreamName identifies the stream of one entity, like an aggregate, as
+// "<category><separator><id>". The category may not contain the separator
+// while the ID may, so names are parsed on the first separator.
+type StreamName struct {
+	category  string
+	id        string
+	separator string
+}
+
+// NewStreamName composes a stream name with the default separator.
+func NewStreamName(category string, id string) (StreamName, error) {
+	return StreamNaming{}.New(category, id)
+}
+
+// ParseStreamName parses a stream name composed with the default separator.
+func ParseStreamName(name string) (StreamName, error) {
+	return StreamNaming{}.Parse(name)
+}
+
+func (n StreamName) Category() string {
+	return n.category
+}
+
+func (n StreamName) ID() string {
+	return n.id
+}
+
+func (n StreamName) String() string {
+	return n.category + n.separator + n.id
+}
+
+// StreamNaming composes and parses stream names with Separator, which
+// defaults to DefaultStreamSeparator.
+type StreamNaming struct {
+	Separator string
+}
+
+func (s StreamNaming) New(category string, id string) (StreamName, error) {
+	separator := s.separator()
+
+	if category == "" || strings.HasPrefix(category, "$") || strings.Contains(category, separator) {
+		return StreamName{}, fmt.Errorf("%w: category %q must not be empty, start with $ or contain %q", ErrInvalidStreamName, category, separator)
+	}
+
+	if id == "" || strings.IndexFunc(id, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return StreamName{}, fmt.Errorf("%w: id %q of %s must not be empty or contain spaces", ErrInvalidStreamName, id, category)
+	}
+
+	return StreamName{category: category, id: id, separator: separator}, nil
+}
+
+func (s StreamNaming) Parse(name string) (StreamName, error) {
+	category, id, ok := strings.Cut(name, s.separator())
+
+	if !ok {
+		return StreamName{}, fmt.Errorf("%w: %q has no %q separator", ErrInvalidStreamName, name, s.separator())
+	}
+
+	return s.New(category, id)
+}
+
+// CategoryFilter matches the streams of the given categories, to subscribe to
+// every entity of a kind.
+func (s StreamNaming) CategoryFilter(categories ...string) *SubscriptionFilter {
+	prefixes := make([]string, len(categories))
+
+	for i, category := range categories {
+		prefixes[i] = category + s.separator()
+	}
+
+	return &SubscriptionFilter{
+		Type:     StreamFilterType,
+		Prefixes: prefixes,
+	}
+}
+
+func (s StreamNaming) separator() string {
+	if s.Separator == "" {
+		return DefaultStreamSeparator
+	}
+
+	return s.Separator
+}
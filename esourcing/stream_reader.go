@@ -0,0 +1,134 @@
+package esourcing
+
+import (
+	"context"
+)
+
+// DefaultReadBatchSize is the number of events a StreamReader fetches per page
+// when no batch size is given.
+const DefaultReadBatchSize uint64 = 500
+
+// StreamReader pages through a stream of any length, fetching batchSize events
+// at a time. It is used like sql.Rows:
+//
+//	reader := NewStreamReader(store, streamID, options, 0)
+//
+//	for reader.Next(ctx) {
+//		event := reader.Event()
+//	}
+//
+//	if err := reader.Err(); err != nil {
+//		...
+//	}
+//
+// Next returns false both at the end of the stream and on failure; Err tells
+// them apart. A stream that does not exist fails with ErrStreamNotFound.
+type StreamReader struct {
+	store     EventStore
+	streamID  string
+	options   ReadStreamOptions
+	batchSize uint64
+	batch     []Event
+	event     Event
+	last      bool
+	err       error
+}
+
+func NewStreamReader(store EventStore, streamID string, options ReadStreamOptions, batchSize uint64) *StreamReader {
+	if batchSize == 0 {
+		batchSize = DefaultReadBatchSize
+	}
+
+	if options.From == nil {
+		options.From = Start{}
+	}
+
+	return &StreamReader{
+		store:     store,
+		streamID:  streamID,
+		options:   options,
+		batchSize: batchSize,
+	}
+}
+
+// Next advances to the next event, reading the next page of the stream when
+// the current one is exhausted.
+func (r *StreamReader) Next(ctx context.Context) bool {
+	if r.err != nil {
+		return false
+	}
+
+	if len(r.batch) == 0 && !r.last {
+		r.err = r.readBatch(ctx)
+
+		if r.err != nil {
+			return false
+		}
+	}
+
+	if len(r.batch) == 0 {
+		r.event = nil
+		return false
+	}
+
+	r.event, r.batch = r.batch[0], r.batch[1:]
+
+	return true
+}
+
+// Event returns the event Next advanced to.
+func (r *StreamReader) Event() Event {
+	return r.event
+}
+
+// Err returns the error that stopped the reader, or nil when it reached the
+// end of the stream.
+func (r *StreamReader) Err() error {
+	return r.err
+}
+
+func (r *StreamReader) readBatch(ctx context.Context) error {
+	events, err := r.store.ReadStream(ctx, r.streamID, r.options, r.batchSize)
+
+	if err != nil {
+		return err
+	}
+
+	r.batch = events
+	r.last = uint64(len(events)) < r.batchSize
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	next := events[len(events)-1].SequenceNumber()
+
+	if r.options.Direction == Backwards {
+		if next == 0 {
+			r.last = true
+			return nil
+		}
+
+		next--
+	} else {
+		next++
+	}
+
+	r.options.From = Revision(uint64(next))
+
+	return nil
+}
+
+// ReadFullStream reads all the events of a stream from options.From, paging
+// through it batchSize events at a time.
+func ReadFullStream(ctx context.Context, store EventStore, streamID string, options ReadStreamOptions, batchSize uint64) ([]Event, error) {
+	var events []Event
+
+	reader := NewStreamReader(store, streamID, options, batchSize)
+
+	for reader.Next(ctx) {
+		events = append(events, reader.Event())
+	}
+
+	return events, reader.Err()
+}
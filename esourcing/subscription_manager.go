@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-
-	"github.com/EventStore/EventStore-Client-Go/esdb"
 )
 
 type subscriptionManager struct {
@@ -24,7 +22,7 @@ func (sm *subscriptionManager) CreateSubscriptionIfNotExists(subscriptionID stri
 	return err
 }
 
-func (sm *subscriptionManager) LastCheckpoint(subscriptionID string) (*esdb.Position, error) {
+func (sm *subscriptionManager) LastCheckpoint(subscriptionID string) (*Position, error) {
 	row := sm.db.QueryRow("SELECT coalesce(checkpoint_position, '') FROM es_subscription_checkpoint WHERE subscription_id = ?", subscriptionID)
 
 	var lastPosition string
@@ -43,14 +41,19 @@ func (sm *subscriptionManager) LastCheckpoint(subscriptionID string) (*esdb.Posi
 	prepare, _ := strconv.ParseUint(positions[0], 10, 64)
 	commit, _ := strconv.ParseUint(positions[1], 10, 64)
 
-	return &esdb.Position{
+	return &Position{
 		Prepare: prepare,
 		Commit:  commit,
 	}, nil
 }
 
-func (sm *subscriptionManager) SaveCheckpoint(subscriptionID string, position *esdb.Position, tx *sql.Tx) error {
+func (sm *subscriptionManager) SaveCheckpoint(subscriptionID string, position *Position, tx *sql.Tx) error {
 	checkpointPosition := fmt.Sprintf("%v:%v", position.Prepare, position.Commit)
 	_, err := tx.Exec("UPDATE es_subscription_checkpoint SET checkpoint_position = ?, checkpoint_at = now() WHERE subscription_id = ?", checkpointPosition, subscriptionID)
 	return err
 }
+
+func (sm *subscriptionManager) ResetCheckpoint(subscriptionID string, tx *sql.Tx) error {
+	_, err := tx.Exec("UPDATE es_subscription_checkpoint SET checkpoint_position = NULL, checkpoint_at = now() WHERE subscription_id = ?", subscriptionID)
+	return err
+}
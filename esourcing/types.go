@@ -0,0 +1,233 @@
+package esourcing
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrStreamNotFound = fmt.Errorf("stream not found")
+var ErrPersistentSubscriptionNotSupported = fmt.Errorf("persistent subscriptions are not supported by this event store")
+
+// StreamDeletedError is returned when reading or appending to a tombstoned
+// stream. Unlike a soft-deleted stream, it can never be written to again.
+type StreamDeletedError struct {
+	StreamID string
+}
+
+func (e *StreamDeletedError) Error() string {
+	return fmt.Sprintf("stream %s is deleted", e.StreamID)
+}
+
+type ContentType string
+
+const (
+	JsonContentType     ContentType = "application/json"
+	BinaryContentType   ContentType = "application/octet-stream"
+	ProtobufContentType ContentType = "application/x-protobuf"
+)
+
+type Direction int
+
+const (
+	Forwards Direction = iota
+	Backwards
+)
+
+// Position is the location of an event in the global log of the store.
+type Position struct {
+	Commit  uint64
+	Prepare uint64
+}
+
+// StreamRevision is the zero-based number of an event inside its stream.
+type StreamRevision struct {
+	Value uint64
+}
+
+func Revision(value uint64) StreamRevision {
+	return StreamRevision{Value: value}
+}
+
+type Start struct{}
+
+type End struct{}
+
+// StreamPosition is where a stream read or subscription starts: Start, End or
+// a StreamRevision.
+type StreamPosition interface {
+	isStreamPosition()
+}
+
+// AllPosition is where a read or subscription of the global log starts: Start,
+// End or a Position.
+type AllPosition interface {
+	isAllPosition()
+}
+
+func (Start) isStreamPosition()          {}
+func (End) isStreamPosition()            {}
+func (StreamRevision) isStreamPosition() {}
+
+func (Start) isAllPosition()    {}
+func (End) isAllPosition()      {}
+func (Position) isAllPosition() {}
+
+type Any struct{}
+
+type NoStream struct{}
+
+type StreamExists struct{}
+
+// ExpectedRevision is the state a stream must be in for an append to succeed:
+// Any, NoStream, StreamExists or a StreamRevision.
+type ExpectedRevision interface {
+	isExpectedRevision()
+}
+
+func (Any) isExpectedRevision()            {}
+func (NoStream) isExpectedRevision()       {}
+func (StreamExists) isExpectedRevision()   {}
+func (StreamRevision) isExpectedRevision() {}
+
+// acceptsExpectedRevision reports whether a stream currently at revision
+// satisfies the expected revision of an append.
+func acceptsExpectedRevision(expectedRevision ExpectedRevision, revision int64, exists bool) bool {
+	switch expected := expectedRevision.(type) {
+	case NoStream:
+		return !exists
+	case StreamExists:
+		return exists
+	case StreamRevision:
+		return exists && revision == int64(expected.Value)
+	}
+
+	return true
+}
+
+type ReadStreamOptions struct {
+	Direction Direction
+	From      StreamPosition
+}
+
+// ReadAllOptions select the events of a global log read. From is exclusive,
+// so the position of the last event read is where the next page starts.
+type ReadAllOptions struct {
+	Direction Direction
+	From      AllPosition
+	Filter    *SubscriptionFilter
+}
+
+type FilterType int
+
+const (
+	EventFilterType FilterType = iota
+	StreamFilterType
+)
+
+type SubscriptionFilter struct {
+	Type     FilterType
+	Prefixes []string
+	Regex    string
+}
+
+type SubscribeToAllOptions struct {
+	From   AllPosition
+	Filter *SubscriptionFilter
+}
+
+type SubscribeToStreamOptions struct {
+	From StreamPosition
+}
+
+type PersistentSubscriptionOptions struct {
+	From StreamPosition
+}
+
+type WriteResult struct {
+	Position             Position
+	NextExpectedRevision uint64
+}
+
+// EventData is an event ready to be appended to a stream.
+type EventData struct {
+	EventID     string
+	EventType   string
+	ContentType ContentType
+	Data        []byte
+	Metadata    []byte
+}
+
+// RecordedEvent is an event as persisted by the store.
+type RecordedEvent struct {
+	EventID     string
+	EventType   string
+	ContentType ContentType
+	StreamID    string
+	EventNumber uint64
+	Position    Position
+	CreatedDate time.Time
+	Data        []byte
+	Metadata    []byte
+}
+
+// ResolvedEvent is a decoded event read from the global log, with the stream
+// it belongs to, its position in the log and the event as stored.
+type ResolvedEvent struct {
+	Event         Event
+	StreamID      string
+	Position      Position
+	RecordedEvent *RecordedEvent
+}
+
+// UndecodableEventError is returned by ReadAll, along with the events read
+// before it, when an event of the log cannot be decoded.
+type UndecodableEventError struct {
+	RecordedEvent *RecordedEvent
+	Err           error
+}
+
+func (e *UndecodableEventError) Error() string {
+	return fmt.Sprintf("error when decoding event %s@%s: %v", e.RecordedEvent.EventType, e.RecordedEvent.EventID, e.Err)
+}
+
+func (e *UndecodableEventError) Unwrap() error {
+	return e.Err
+}
+
+type SubscriptionDropped struct {
+	Error error
+}
+
+// SubscriptionEvent is what a Subscription delivers on each Recv: either an
+// appeared event, a checkpoint reached by a filtered subscription, or the
+// reason the subscription was dropped.
+type SubscriptionEvent struct {
+	EventAppeared       *RecordedEvent
+	CheckpointReached   *Position
+	SubscriptionDropped *SubscriptionDropped
+}
+
+var ErrStreamMetadataNotSupported = fmt.Errorf("stream metadata is not supported by this event store")
+
+// StreamMetadata controls how long the events of a stream are kept and who
+// may access it. Zero values leave the setting unset.
+type StreamMetadata struct {
+	// MaxAge scavenges events older than the duration, with second precision.
+	MaxAge time.Duration
+	// MaxCount keeps only the last MaxCount events of the stream.
+	MaxCount uint64
+	// TruncateBefore hides the events before this stream revision.
+	TruncateBefore uint64
+	ACL            *StreamACL
+	Custom         map[string]string
+}
+
+// StreamACL lists the roles allowed to read, write and delete a stream and to
+// read and write its metadata.
+type StreamACL struct {
+	ReadRoles      []string
+	WriteRoles     []string
+	DeleteRoles    []string
+	MetaReadRoles  []string
+	MetaWriteRoles []string
+}
@@ -0,0 +1,260 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrPendingMigrations = fmt.Errorf("database has pending migrations")
+
+// Migration changes the schema of the database. The migrations of an owner,
+// like a projection, are applied in version order and recorded in the
+// schema_migration table so each one runs once. MySQL commits DDL statements
+// implicitly, so a migration failing halfway through is not rolled back and
+// should be written to be rerun.
+type Migration struct {
+	Owner       string
+	Version     int
+	Description string
+	Up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Statements returns an Up function executing queries in order.
+func Statements(queries ...string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// MigrationStatus tells whether a migration was applied, and when.
+type MigrationStatus struct {
+	Migration Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	versions   map[string]int
+}
+
+func NewMigrator(db *sql.DB) *Migrator {
+	return &Migrator{
+		db:       db,
+		versions: map[string]int{},
+	}
+}
+
+// Register adds migrations, which are applied in registration order. The
+// versions of an owner must be positive and increasing.
+func (m *Migrator) Register(migrations ...Migration) error {
+	for _, migration := range migrations {
+		if migration.Owner == "" || migration.Up == nil {
+			return fmt.Errorf("migration %d %q must have an owner and an Up function", migration.Version, migration.Description)
+		}
+
+		if migration.Version <= m.versions[migration.Owner] {
+			return fmt.Errorf("migration %d of %s must come after version %d", migration.Version, migration.Owner, m.versions[migration.Owner])
+		}
+
+		m.versions[migration.Owner] = migration.Version
+		m.migrations = append(m.migrations, migration)
+	}
+
+	return nil
+}
+
+// Migrate applies the pending migrations and returns them. Concurrent runs are
+// serialized with a MySQL named lock.
+func (m *Migrator) Migrate(ctx context.Context) ([]Migration, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	var locked sql.NullInt64
+
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK('schema_migration', 60)").Scan(&locked); err != nil {
+		return nil, fmt.Errorf("error when locking migrations: %w", err)
+	}
+
+	if locked.Int64 != 1 {
+		return nil, fmt.Errorf("error when locking migrations: another migration is running")
+	}
+
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK('schema_migration')")
+
+	if err := createSchemaTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	pending, err := m.pending(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, migration := range pending {
+		if err := apply(ctx, conn, migration); err != nil {
+			return pending[:i], err
+		}
+
+		log.Printf("Applied migration %d of %s: %s\n", migration.Version, migration.Owner, migration.Description)
+	}
+
+	return pending, nil
+}
+
+// Pending returns the migrations that were not applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := createSchemaTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	return m.pending(ctx, conn)
+}
+
+// RequireMigrated fails with ErrPendingMigrations unless every migration was
+// applied, so processes never start against an outdated schema.
+func (m *Migrator) RequireMigrated(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d to apply with db:migrate", ErrPendingMigrations, len(pending))
+	}
+
+	return nil
+}
+
+// Status lists every registered migration with the time it was applied at.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := createSchemaTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Migration: migration}
+
+		if appliedAt, ok := applied[migrationKey{migration.Owner, migration.Version}]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) pending(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migrationKey{migration.Owner, migration.Version}]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := migration.Up(ctx, tx); err != nil {
+		return fmt.Errorf("error when applying migration %d of %s: %w", migration.Version, migration.Owner, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_migration (owner, version, description) VALUES (?, ?, ?)", migration.Owner, migration.Version, migration.Description)
+	if err != nil {
+		return fmt.Errorf("error when recording migration %d of %s: %w", migration.Version, migration.Owner, err)
+	}
+
+	return tx.Commit()
+}
+
+type migrationKey struct {
+	owner   string
+	version int
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[migrationKey]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT owner, version, UNIX_TIMESTAMP(applied_at) FROM schema_migration")
+	if err != nil {
+		return nil, fmt.Errorf("error when reading applied migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	applied := map[migrationKey]time.Time{}
+
+	for rows.Next() {
+		var key migrationKey
+		var appliedAt int64
+
+		if err := rows.Scan(&key.owner, &key.version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error when reading applied migrations: %w", err)
+		}
+
+		applied[key] = time.Unix(appliedAt, 0)
+	}
+
+	return applied, rows.Err()
+}
+
+func createSchemaTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migration (
+		owner VARCHAR(255) NOT NULL,
+		version INT NOT NULL,
+		description VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (owner, version)
+	);`)
+
+	if err != nil {
+		return fmt.Errorf("error when creating schema_migration table: %w", err)
+	}
+
+	return nil
+}
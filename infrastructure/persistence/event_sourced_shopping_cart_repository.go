@@ -5,84 +5,60 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/EventStore/EventStore-Client-Go/esdb"
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/repository"
 	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
-	"github.com/google/uuid"
+	"github.com/gofrs/uuid"
 )
 
 var ErrShoppingCartNotFound = fmt.Errorf("cart not found")
 
 type eventSourcedShoppingCartRepository struct {
-	eventstore esourcing.EventStore
+	repository *esourcing.Repository[*entity.ShoppingCart]
 }
 
 func NewEventSourcedShoppingCartRepository(eventstore esourcing.EventStore) repository.ShoppingCartRepository {
 	return &eventSourcedShoppingCartRepository{
-		eventstore: eventstore,
+		repository: esourcing.NewRepository(eventstore, entity.ShoppingCartAggregateType, entity.NewEmptyShoppingCart, esourcing.RepositoryConfig{}),
 	}
 }
 
-func (r *eventSourcedShoppingCartRepository) FindByID(ctx context.Context, cartID string) (cart *entity.ShoppingCart, err error) {
-	streamID := r.streamID(cartID)
+func NewEventSourcedShoppingCartRepositoryWithSnapshots(eventstore esourcing.EventStore, snapshotStore esourcing.SnapshotStore, snapshotPolicy esourcing.SnapshotPolicy) repository.ShoppingCartRepository {
+	return NewEventSourcedShoppingCartRepositoryWithConfig(eventstore, esourcing.RepositoryConfig{
+		SnapshotStore:  snapshotStore,
+		SnapshotPolicy: snapshotPolicy,
+	})
+}
 
-	options := esdb.ReadStreamOptions{
-		Direction:      esdb.Forwards,
-		From:           esdb.Start{},
-		ResolveLinkTos: false,
+func NewEventSourcedShoppingCartRepositoryWithConfig(eventstore esourcing.EventStore, config esourcing.RepositoryConfig) repository.ShoppingCartRepository {
+	return &eventSourcedShoppingCartRepository{
+		repository: esourcing.NewRepository(eventstore, entity.ShoppingCartAggregateType, entity.NewEmptyShoppingCart, config),
 	}
+}
 
-	var events []esourcing.Event
-
-	storedEvents, err := r.eventstore.ReadStream(ctx, streamID, options, 3000)
-
-	if errors.Is(err, esdb.ErrStreamNotFound) {
-		return cart, ErrShoppingCartNotFound
-	}
+func (r *eventSourcedShoppingCartRepository) FindByID(ctx context.Context, cartID string) (*entity.ShoppingCart, error) {
+	cart, err := r.repository.Load(ctx, cartID)
 
-	if err != nil {
-		return cart, err
+	// An ID that cannot name a stream cannot belong to an existing cart.
+	if errors.Is(err, esourcing.ErrAggregateNotFound) || errors.Is(err, esourcing.ErrInvalidStreamName) {
+		return nil, ErrShoppingCartNotFound
 	}
 
-	events = append(events, storedEvents...)
-
-	cart = entity.NewShoppingCart(cartID)
-	cart.ClearUncommittedEvents()
-
-	esourcing.RebuildFromEvents(cart, events)
-
-	return cart, nil
+	return cart, err
 }
 
 func (r *eventSourcedShoppingCartRepository) Save(ctx context.Context, cart *entity.ShoppingCart) error {
-	uncommitedEvents := cart.UncommittedEvents()
-
-	if len(uncommitedEvents) == 0 {
-		return nil
-	}
-
-	if len(cart.AggregateID()) == 0 {
-		return errors.New("aggregate id cannot be empty")
-	}
-
-	streamID := r.streamID(cart.AggregateID())
-
-	_, err := r.eventstore.AppendToStream(ctx, streamID, uncommitedEvents)
-
-	if err != nil {
-		return err
-	}
-
-	cart.ClearUncommittedEvents()
+	return r.repository.Save(ctx, cart)
+}
 
-	return nil
+func (r *eventSourcedShoppingCartRepository) Delete(ctx context.Context, cart *entity.ShoppingCart) error {
+	return r.repository.Delete(ctx, cart)
 }
 
-func (r *eventSourcedShoppingCartRepository) NextIdentity() string {
-	return uuid.NewString()
+func (r *eventSourcedShoppingCartRepository) Purge(ctx context.Context, cart *entity.ShoppingCart) error {
+	return r.repository.Tombstone(ctx, cart)
 }
 
-func (r *eventSourcedShoppingCartRepository) streamID(aggregateID string) string {
-	return fmt.Sprintf("%s#%s", entity.ShoppingCartAggregateType.String(), aggregateID)
+func (r *eventSourcedShoppingCartRepository) NextIdentity() string {
+	return uuid.Must(uuid.NewV4()).String()
 }
@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/event"
+	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+)
+
+// newBenchmarkCartStore returns an in-memory store with the marshaller
+// configured like main, compressing payloads from threshold bytes on when
+// threshold is not negative.
+func newBenchmarkCartStore(b *testing.B, threshold int) esourcing.EventStore {
+	store := esourcing.NewInMemoryEventStore()
+
+	if err := event.RegisterEventTypes(store); err != nil {
+		b.Fatal(err)
+	}
+
+	marshaller := store.GetMarshaller()
+	marshaller.RegisterSerializer(esourcing.NewProtobufSerializer())
+	marshaller.EncryptPersonalData(esourcing.NewInMemoryKeyStore())
+
+	if threshold >= 0 {
+		marshaller.CompressPayloads(esourcing.NewGzipCompressor(gzip.BestSpeed), threshold)
+	}
+
+	if err := marshaller.UseSerializer(event.ShoppingCartItemAddedName, esourcing.ProtobufContentType); err != nil {
+		b.Fatal(err)
+	}
+
+	return store
+}
+
+// newBenchmarkCart returns a cart that had items added and removed a few
+// times before being checked out.
+func newBenchmarkCart(b *testing.B, ctx context.Context, cartID string) *entity.ShoppingCart {
+	cart := entity.NewShoppingCart(ctx, cartID)
+
+	for i := 0; i < 10; i++ {
+		productID := fmt.Sprint(100 + i)
+
+		if err := cart.AddItem(ctx, productID, fmt.Sprintf("Product %d", i), 10.5, 1+i%3); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := cart.RemoveItem(ctx, productID); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	if err := cart.AddItem(ctx, "200", "Book", 12.5, 1); err != nil {
+		b.Fatal(err)
+	}
+
+	customer := entity.Customer{ID: "customer-1", Name: "Jane Doe", Email: "jane@example.com"}
+
+	if err := cart.Checkout(ctx, customer); err != nil {
+		b.Fatal(err)
+	}
+
+	return cart
+}
+
+// BenchmarkShoppingCartStream saves and loads a shopping cart stream with and
+// without payload compression, reporting the stored payload bytes per event.
+func BenchmarkShoppingCartStream(b *testing.B) {
+	cases := []struct {
+		name      string
+		threshold int
+	}{
+		{"uncompressed", -1},
+		{"gzip", 0},
+	}
+
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			ctx := context.Background()
+			store := newBenchmarkCartStore(b, c.threshold)
+			repository := NewEventSourcedShoppingCartRepository(store)
+			marshaller := store.GetMarshaller()
+
+			var payloadBytes int
+			cart := newBenchmarkCart(b, ctx, "measured")
+			events := cart.UncommittedEvents()
+
+			for _, evt := range events {
+				eventData, err := marshaller.ToEventData(ctx, evt)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				payloadBytes += len(eventData.Data)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				cartID := fmt.Sprint(i)
+
+				if err := repository.Save(ctx, newBenchmarkCart(b, ctx, cartID)); err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err := repository.FindByID(ctx, cartID); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(payloadBytes)/float64(len(events)), "B/event")
+		})
+	}
+}
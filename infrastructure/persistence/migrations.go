@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+	"github.com/feralc/golang-sp-2024-eventsourcing/infrastructure/migration"
+)
+
+// KeyStoreMigrations create the tables of the personal data key store, which
+// is kept in the database whatever the event store.
+var KeyStoreMigrations = []migration.Migration{
+	{
+		Owner:       "key-store",
+		Version:     1,
+		Description: "create es_subject_key",
+		Up:          migration.Statements(esourcing.MySQLDialect.KeyStoreSchema()...),
+	},
+	{
+		Owner:       "key-store",
+		Version:     2,
+		Description: "create es_forgotten_subject",
+		Up:          migration.Statements(esourcing.MySQLDialect.ForgottenSubjectSchema()...),
+	},
+}
+
+// SQLEventStoreMigrations create the tables of the event and snapshot stores
+// when events are kept in the database instead of EventStoreDB.
+var SQLEventStoreMigrations = []migration.Migration{
+	{
+		Owner:       "sql-event-store",
+		Version:     1,
+		Description: "create es_event and es_stream",
+		Up:          migration.Statements(esourcing.MySQLDialect.EventStoreSchema()...),
+	},
+	{
+		Owner:       "sql-event-store",
+		Version:     2,
+		Description: "create es_snapshot",
+		Up:          migration.Statements(esourcing.MySQLDialect.SnapshotStoreSchema()...),
+	},
+	{
+		Owner:       "sql-event-store",
+		Version:     3,
+		Description: "create es_append_lock",
+		// Replaced by es_position in version 4.
+		Up: migration.Statements(
+			`CREATE TABLE IF NOT EXISTS es_append_lock (
+				id INT PRIMARY KEY
+			);`,
+			`INSERT IGNORE INTO es_append_lock (id) VALUES (1);`,
+		),
+	},
+	{
+		Owner:       "sql-event-store",
+		Version:     4,
+		Description: "create es_position and drop es_append_lock",
+		Up: migration.Statements(append(
+			esourcing.MySQLDialect.PositionSchema(),
+			`DROP TABLE IF EXISTS es_append_lock;`,
+		)...),
+	},
+}
@@ -0,0 +1,170 @@
+package projection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+)
+
+var ErrDeadLetterNotFound = fmt.Errorf("dead letter not found")
+
+// DeadLetter is a poison event parked by a projection in es_dead_letter, see
+// RetryPolicy. It can be retried once the cause is fixed, or discarded.
+type DeadLetter struct {
+	ID             int64
+	ProjectionName string
+	SubscriptionID string
+	Event          esourcing.RecordedEvent
+	Error          string
+	Attempts       int
+	ParkedAt       time.Time
+}
+
+const deadLetterColumns = `id, projection_name, subscription_id, event_id, event_type, content_type, stream_id, stream_revision,
+	commit_position, prepare_position, data, metadata, created_at, error, attempts, UNIX_TIMESTAMP(parked_at)`
+
+// parkEvent parks the event along with the checkpoint, so the projection
+// resumes after it.
+func (p *Projection) parkEvent(ctx context.Context, recordedEvent *esourcing.RecordedEvent, subscriptionID string, attempts int, cause error) error {
+	ctx = context.WithoutCancel(ctx)
+
+	tx, err := p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO es_dead_letter (projection_name, subscription_id, event_id, event_type, content_type, stream_id,
+		stream_revision, commit_position, prepare_position, data, metadata, created_at, error, attempts)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.projectionName, subscriptionID, recordedEvent.EventID, recordedEvent.EventType, string(recordedEvent.ContentType), recordedEvent.StreamID,
+		recordedEvent.EventNumber, recordedEvent.Position.Commit, recordedEvent.Position.Prepare, recordedEvent.Data, recordedEvent.Metadata,
+		recordedEvent.CreatedDate.UnixNano(), cause.Error(), attempts)
+	if err != nil {
+		return fmt.Errorf("error when parking event %s@%s: %w", recordedEvent.EventType, recordedEvent.EventID, err)
+	}
+
+	if !p.isPersistent {
+		err = p.subscriptionManager.SaveCheckpoint(subscriptionID, &recordedEvent.Position, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeadLetters returns the events parked by the projection, oldest first.
+func (p *Projection) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	rows, err := p.svc.GetBD().QueryContext(ctx, "SELECT "+deadLetterColumns+" FROM es_dead_letter WHERE projection_name = ? ORDER BY id", p.projectionName)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading dead letters of projection %s: %w", p.projectionName, err)
+	}
+
+	defer rows.Close()
+
+	deadLetters := []DeadLetter{}
+
+	for rows.Next() {
+		deadLetter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, rows.Err()
+}
+
+// RetryDeadLetter projects a parked event again with handleEventFunc and
+// removes it once projected. The events that followed it have already been
+// projected, so the handler must not depend on their order.
+func (p *Projection) RetryDeadLetter(ctx context.Context, id int64, handleEventFunc EventProjectionHandleFunc) error {
+	tx, err := p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT "+deadLetterColumns+" FROM es_dead_letter WHERE id = ? AND projection_name = ? FOR UPDATE", id, p.projectionName)
+
+	deadLetter, err := scanDeadLetter(row)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %d of projection %s", ErrDeadLetterNotFound, id, p.projectionName)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	event, err := p.store.GetMarshaller().FromRecordedEvent(ctx, &deadLetter.Event)
+	if err == nil {
+		err = handleEventFunc(esourcing.ContextFromEvent(ctx, event), event, tx)
+	}
+
+	if err != nil {
+		tx.Rollback()
+
+		_, updateErr := p.svc.GetBD().ExecContext(ctx, "UPDATE es_dead_letter SET error = ?, attempts = attempts + 1 WHERE id = ?", err.Error(), id)
+		if updateErr != nil {
+			return fmt.Errorf("error when retrying dead letter %d: %w (and when recording it: %v)", id, err, updateErr)
+		}
+
+		return fmt.Errorf("error when retrying dead letter %d: %w", id, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM es_dead_letter WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DiscardDeadLetter removes a parked event without projecting it.
+func (p *Projection) DiscardDeadLetter(ctx context.Context, id int64) error {
+	result, err := p.svc.GetBD().ExecContext(ctx, "DELETE FROM es_dead_letter WHERE id = ? AND projection_name = ?", id, p.projectionName)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return fmt.Errorf("%w: %d of projection %s", ErrDeadLetterNotFound, id, p.projectionName)
+	}
+
+	return nil
+}
+
+// discardDeadLetters removes the events parked by a subscription, e.g. of a
+// version of the projection that was replaced.
+func discardDeadLetters(ctx context.Context, tx *sql.Tx, subscriptionID string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM es_dead_letter WHERE subscription_id = ?", subscriptionID); err != nil {
+		return fmt.Errorf("error when discarding dead letters of %s: %w", subscriptionID, err)
+	}
+
+	return nil
+}
+
+func scanDeadLetter(row interface{ Scan(dest ...any) error }) (DeadLetter, error) {
+	var deadLetter DeadLetter
+	var contentType string
+	var createdAt, parkedAt int64
+
+	err := row.Scan(&deadLetter.ID, &deadLetter.ProjectionName, &deadLetter.SubscriptionID, &deadLetter.Event.EventID, &deadLetter.Event.EventType,
+		&contentType, &deadLetter.Event.StreamID, &deadLetter.Event.EventNumber, &deadLetter.Event.Position.Commit, &deadLetter.Event.Position.Prepare,
+		&deadLetter.Event.Data, &deadLetter.Event.Metadata, &createdAt, &deadLetter.Error, &deadLetter.Attempts, &parkedAt)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+
+	deadLetter.Event.ContentType = esourcing.ContentType(contentType)
+	deadLetter.Event.CreatedDate = time.Unix(0, createdAt).UTC()
+	deadLetter.ParkedAt = time.Unix(parkedAt, 0).UTC()
+
+	return deadLetter, nil
+}
@@ -0,0 +1,52 @@
+package projection
+
+import "github.com/feralc/golang-sp-2024-eventsourcing/infrastructure/migration"
+
+// Migrations create the tables shared by every projection. The read model
+// tables of each projection are owned by its ProjectionSchema.
+var Migrations = []migration.Migration{
+	{
+		Owner:       "projection",
+		Version:     1,
+		Description: "create es_subscription_checkpoint",
+		Up: migration.Statements(`CREATE TABLE IF NOT EXISTS es_subscription_checkpoint (
+			subscription_id VARCHAR(255) PRIMARY KEY,
+			checkpoint_position VARCHAR(255),
+			checkpoint_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`),
+	},
+	{
+		Owner:       "projection",
+		Version:     2,
+		Description: "create es_projection_version",
+		Up: migration.Statements(`CREATE TABLE IF NOT EXISTS es_projection_version (
+			projection_name VARCHAR(255) PRIMARY KEY,
+			active_version INT NOT NULL
+		);`),
+	},
+	{
+		Owner:       "projection",
+		Version:     3,
+		Description: "create es_dead_letter",
+		Up: migration.Statements(`CREATE TABLE IF NOT EXISTS es_dead_letter (
+			id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			projection_name VARCHAR(255) NOT NULL,
+			subscription_id VARCHAR(255) NOT NULL,
+			event_id VARCHAR(36) NOT NULL,
+			event_type VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			stream_id VARCHAR(255) NOT NULL,
+			stream_revision BIGINT UNSIGNED NOT NULL,
+			commit_position BIGINT UNSIGNED NOT NULL,
+			prepare_position BIGINT UNSIGNED NOT NULL,
+			data LONGBLOB,
+			metadata LONGBLOB,
+			created_at BIGINT NOT NULL,
+			error TEXT NOT NULL,
+			attempts INT NOT NULL,
+			parked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			INDEX es_dead_letter_projection (projection_name),
+			INDEX es_dead_letter_subscription (subscription_id)
+		);`),
+	},
+}
@@ -3,13 +3,22 @@ package projection
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
-	"github.com/EventStore/EventStore-Client-Go/esdb"
 	"github.com/feralc/golang-sp-2024-eventsourcing/application/service"
 	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
 )
 
+// rebuildBatchSize is the number of events replayed per transaction by Rebuild.
+const rebuildBatchSize = 500
+
+// errVersionSwitched stops RunVersioned from projecting into a version that
+// is no longer active.
+var errVersionSwitched = errors.New("projection version switched")
+
 type EventProjectionHandleFunc func(ctx context.Context, evt esourcing.Event, tx *sql.Tx) (err error)
 
 type Projection struct {
@@ -17,9 +26,11 @@ type Projection struct {
 	store               esourcing.EventStore
 	subscriptionManager esourcing.SubscriptionManager
 	projectionName      string
+	schema              *ProjectionSchema
 	streamName          string
 	groupName           string
 	isPersistent        bool
+	retryPolicy         RetryPolicy
 }
 
 func NewProjection(svc *service.Service, store esourcing.EventStore, projectionName string) *Projection {
@@ -29,6 +40,20 @@ func NewProjection(svc *service.Service, store esourcing.EventStore, projectionN
 		subscriptionManager: esourcing.NewSubscriptionManager(svc.GetBD()),
 		projectionName:      projectionName,
 		isPersistent:        false,
+		retryPolicy:         DefaultRetryPolicy,
+	}
+}
+
+// NewVersionedProjection returns a projection into the tables of schema, which
+// can be rebuilt into a new version without downtime.
+func NewVersionedProjection(svc *service.Service, store esourcing.EventStore, schema ProjectionSchema) *Projection {
+	return &Projection{
+		svc:                 svc,
+		store:               store,
+		subscriptionManager: esourcing.NewSubscriptionManager(svc.GetBD()),
+		projectionName:      schema.Name,
+		schema:              &schema,
+		retryPolicy:         DefaultRetryPolicy,
 	}
 }
 
@@ -41,54 +66,308 @@ func NewProjectionWithPersistentSubscription(svc *service.Service, store esourci
 		groupName:           groupName,
 		isPersistent:        true,
 		subscriptionManager: esourcing.NewSubscriptionManager(svc.GetBD()),
+		retryPolicy:         DefaultRetryPolicy,
 	}
 }
 
-func (p *Projection) Run(ctx context.Context, evtPrefixes []string, handleEventFunc EventProjectionHandleFunc) {
-	if err := p.subscriptionManager.CreateSubscriptionIfNotExists(p.projectionName); err != nil {
-		panic(err)
-	}
+// WithRetryPolicy replaces DefaultRetryPolicy, unset fields keep their default.
+func (p *Projection) WithRetryPolicy(policy RetryPolicy) *Projection {
+	p.retryPolicy = policy.withDefaults()
+	return p
+}
 
-	startFrom, err := p.getStartFrom(ctx)
-	if err != nil {
-		panic(err)
-	}
+// Run projects the events whose type starts with one of evtPrefixes.
+func (p *Projection) Run(ctx context.Context, evtPrefixes []string, handleEventFunc EventProjectionHandleFunc) error {
+	return p.RunWithFilter(ctx, &esourcing.SubscriptionFilter{
+		Type:     esourcing.EventFilterType,
+		Prefixes: evtPrefixes,
+	}, handleEventFunc)
+}
+
+// RunForCategories projects every event of the streams of the given
+// categories, e.g. all the events of an aggregate type.
+func (p *Projection) RunForCategories(ctx context.Context, naming esourcing.StreamNaming, categories []string, handleEventFunc EventProjectionHandleFunc) error {
+	return p.RunWithFilter(ctx, naming.CategoryFilter(categories...), handleEventFunc)
+}
 
+// RunWithFilter projects the matching events until ctx is cancelled, in which
+// case it returns nil, or the subscription fails.
+func (p *Projection) RunWithFilter(ctx context.Context, filter *esourcing.SubscriptionFilter, handleEventFunc EventProjectionHandleFunc) error {
 	if p.isPersistent {
-		subscription, err := p.getPersistentSubscription(ctx, esdb.ConnectToPersistentSubscriptionOptions{})
+		subscription, err := p.getPersistentSubscription(ctx)
 		if err != nil {
-			log.Fatalln(err.Error())
-			panic(err)
+			return err
 		}
 
-		err = p.handleEventsFromPersistentSubscription(ctx, subscription, handleEventFunc)
+		return p.handleEventsFromSubscription(ctx, subscription, p.projectionName, handleEventFunc)
+	}
+
+	return p.subscribe(ctx, p.projectionName, filter, handleEventFunc)
+}
+
+// RunVersioned projects into the tables of the active version of the
+// projection. When a rebuild switches to a new version, it resumes from the
+// checkpoint of the new version.
+func (p *Projection) RunVersioned(ctx context.Context, filter *esourcing.SubscriptionFilter, handlerFor func(version int) EventProjectionHandleFunc) error {
+	for {
+		version, err := p.activeVersion(ctx)
 		if err != nil {
-			panic(err)
+			return err
+		}
+
+		log.Printf("Projecting %s into version %d\n", p.projectionName, version)
+
+		handleEventFunc := handlerFor(version)
+
+		err = p.subscribe(ctx, p.schema.SubscriptionID(version), filter, func(ctx context.Context, evt esourcing.Event, tx *sql.Tx) error {
+			active, err := ActiveVersion(ctx, tx, p.projectionName)
+			if err != nil {
+				return err
+			}
+
+			if active != version {
+				return errVersionSwitched
+			}
+
+			return handleEventFunc(ctx, evt, tx)
+		})
+
+		if errors.Is(err, errVersionSwitched) {
+			continue
 		}
-		return
+
+		return err
 	}
+}
 
-	subscriptionOptions := esdb.SubscribeToAllOptions{
-		From: startFrom,
-		Filter: &esdb.SubscriptionFilter{
-			Type:     esdb.EventFilterType,
-			Prefixes: evtPrefixes,
-		},
+func (p *Projection) subscribe(ctx context.Context, subscriptionID string, filter *esourcing.SubscriptionFilter, handleEventFunc EventProjectionHandleFunc) error {
+	if err := p.subscriptionManager.CreateSubscriptionIfNotExists(subscriptionID); err != nil {
+		return err
+	}
+
+	startFrom, err := p.getStartFrom(ctx, subscriptionID)
+	if err != nil {
+		return err
+	}
+
+	subscriptionOptions := esourcing.SubscribeToAllOptions{
+		From:   startFrom,
+		Filter: filter,
 	}
 
 	subscription, err := p.getSubscription(ctx, subscriptionOptions)
 	if err != nil {
-		log.Fatalln(err.Error())
-		panic(err)
+		return err
 	}
 
-	err = p.handleEventsFromSubscription(ctx, subscription, handleEventFunc)
+	return p.handleEventsFromSubscription(ctx, subscription, subscriptionID, handleEventFunc)
+}
+
+// Rebuild builds the next version of the projection into its own tables while
+// the active version keeps serving reads, replaying the matching events of the
+// global log from the start. Once caught up, it switches the query side and
+// RunVersioned over to the new version and drops the tables of the previous
+// one. Like the running projection, it retries the handler and parks poison
+// events, under the checkpoint of the new version.
+func (p *Projection) Rebuild(ctx context.Context, filter *esourcing.SubscriptionFilter, handlerFor func(version int) EventProjectionHandleFunc) error {
+	if p.schema == nil {
+		return fmt.Errorf("projection %s has no schema to rebuild", p.projectionName)
+	}
+
+	active, err := p.activeVersion(ctx)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	version := active + 1
+	subscriptionID := p.schema.SubscriptionID(version)
+
+	if err := p.subscriptionManager.CreateSubscriptionIfNotExists(subscriptionID); err != nil {
+		return err
 	}
+
+	tx, err := p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := p.schema.dropTables(ctx, tx, version); err != nil {
+		return err
+	}
+
+	if err := p.schema.createTables(ctx, tx, version); err != nil {
+		return err
+	}
+
+	if err := p.subscriptionManager.ResetCheckpoint(subscriptionID, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Rebuilding projection %s into version %d...\n", p.projectionName, version)
+
+	handleEventFunc := handlerFor(version)
+	started := time.Now()
+	replayed := 0
+
+	var from esourcing.AllPosition = esourcing.Start{}
+
+	for {
+		events, err := p.store.ReadAll(ctx, esourcing.ReadAllOptions{From: from, Filter: filter}, rebuildBatchSize)
+
+		var undecodable *esourcing.UndecodableEventError
+
+		if err != nil && !errors.As(err, &undecodable) {
+			return err
+		}
+
+		if len(events) > 0 {
+			if err := p.replay(ctx, subscriptionID, events, handleEventFunc); err != nil {
+				return err
+			}
+
+			replayed += len(events)
+			from = events[len(events)-1].Position
+
+			log.Printf("Replayed %d events of projection %s (%.0f events/s)\n", replayed, p.projectionName, float64(replayed)/time.Since(started).Seconds())
+		}
+
+		// The event is parked like the running projection does, as it fails
+		// to decode it too.
+		if undecodable != nil {
+			evt := &esourcing.SubscriptionEvent{EventAppeared: undecodable.RecordedEvent}
+
+			if err := p.projectEvent(ctx, evt, subscriptionID, handleEventFunc); err != nil {
+				return err
+			}
+
+			from = undecodable.RecordedEvent.Position
+
+			continue
+		}
+
+		if len(events) < rebuildBatchSize {
+			break
+		}
+	}
+
+	log.Printf("Rebuilt projection %s from %d events in %s\n", p.projectionName, replayed, time.Since(started).Round(time.Millisecond))
+
+	if err := p.switchVersion(ctx, active, version); err != nil {
+		return err
+	}
+
+	log.Printf("Projection %s switched from version %d to %d\n", p.projectionName, active, version)
+
+	return nil
 }
 
-func (p *Projection) getSubscription(ctx context.Context, subscriptionOptions esdb.SubscribeToAllOptions) (subscription *esdb.Subscription, err error) {
+// switchVersion makes version the active one. Readers and writers of the
+// previous version share-lock it, so its tables are only dropped once they are
+// done and later transactions see the new version. The events parked by the
+// previous version are discarded with its tables.
+func (p *Projection) switchVersion(ctx context.Context, previous int, version int) error {
+	tx, err := p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := switchVersion(ctx, tx, p.projectionName, version); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	tx, err = p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := p.schema.dropTables(ctx, tx, previous); err != nil {
+		return err
+	}
+
+	if err := discardDeadLetters(ctx, tx, p.schema.SubscriptionID(previous)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *Projection) activeVersion(ctx context.Context) (int, error) {
+	tx, err := p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	version, err := ActiveVersion(ctx, tx, p.projectionName)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, tx.Commit()
+}
+
+// replay projects a batch of events and checkpoints the last one in a single
+// transaction. When the batch fails, its events are projected one at a time
+// following the retry policy, like the running projection does, so poison
+// events are parked instead of failing the rebuild.
+func (p *Projection) replay(ctx context.Context, subscriptionID string, events []esourcing.ResolvedEvent, handleEventFunc EventProjectionHandleFunc) error {
+	err := p.replayBatch(ctx, subscriptionID, events, handleEventFunc)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	log.Printf("Replaying batch of projection %s event by event: %v\n", p.projectionName, err)
+
+	for _, resolved := range events {
+		evt := &esourcing.SubscriptionEvent{EventAppeared: resolved.RecordedEvent}
+
+		if err := p.projectEvent(ctx, evt, subscriptionID, handleEventFunc); err != nil {
+			return fmt.Errorf("error when replaying event %s@%s: %w", resolved.Event.EventType(), resolved.Event.EventID(), err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Projection) replayBatch(ctx context.Context, subscriptionID string, events []esourcing.ResolvedEvent, handleEventFunc EventProjectionHandleFunc) error {
+	tx, err := p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, resolved := range events {
+		eventCtx := esourcing.ContextFromEvent(ctx, resolved.Event)
+
+		if err := handleEventFunc(eventCtx, resolved.Event, tx); err != nil {
+			return fmt.Errorf("error when replaying event %s@%s: %w", resolved.Event.EventType(), resolved.Event.EventID(), err)
+		}
+	}
+
+	if err := p.subscriptionManager.SaveCheckpoint(subscriptionID, &events[len(events)-1].Position, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *Projection) getSubscription(ctx context.Context, subscriptionOptions esourcing.SubscribeToAllOptions) (subscription esourcing.Subscription, err error) {
 	subscription, err = p.store.SubscribeToAll(ctx, subscriptionOptions)
 	if err != nil {
 		return subscription, err
@@ -97,8 +376,8 @@ func (p *Projection) getSubscription(ctx context.Context, subscriptionOptions es
 	return subscription, nil
 }
 
-func (p *Projection) getPersistentSubscription(ctx context.Context, subscriptionOptions esdb.ConnectToPersistentSubscriptionOptions) (subscription *esdb.PersistentSubscription, err error) {
-	subscription, err = p.store.PersistentSubscribeToStream(ctx, p.streamName, p.groupName, subscriptionOptions)
+func (p *Projection) getPersistentSubscription(ctx context.Context) (subscription esourcing.Subscription, err error) {
+	subscription, err = p.store.PersistentSubscribeToStream(ctx, p.streamName, p.groupName)
 	if err != nil {
 		return subscription, err
 	}
@@ -106,9 +385,9 @@ func (p *Projection) getPersistentSubscription(ctx context.Context, subscription
 	return subscription, nil
 }
 
-func (p *Projection) getStartFrom(ctx context.Context) (startFrom esdb.AllPosition, err error) {
-	startFrom = esdb.Start{}
-	lastCheckpointPosition, err := p.subscriptionManager.LastCheckpoint(p.projectionName)
+func (p *Projection) getStartFrom(ctx context.Context, subscriptionID string) (startFrom esourcing.AllPosition, err error) {
+	startFrom = esourcing.Start{}
+	lastCheckpointPosition, err := p.subscriptionManager.LastCheckpoint(subscriptionID)
 	if err != nil {
 		return startFrom, err
 	}
@@ -120,99 +399,78 @@ func (p *Projection) getStartFrom(ctx context.Context) (startFrom esdb.AllPositi
 	return startFrom, nil
 }
 
-func (p *Projection) handleEventsFromSubscription(ctx context.Context, subscription *esdb.Subscription, handleEventFunc EventProjectionHandleFunc) (err error) {
+// handleEventsFromSubscription projects the events of the subscription until
+// ctx is cancelled or the subscription is dropped.
+func (p *Projection) handleEventsFromSubscription(ctx context.Context, subscription esourcing.Subscription, subscriptionID string, handleEventFunc EventProjectionHandleFunc) error {
 	defer subscription.Close()
 
-	for {
+	for ctx.Err() == nil {
 		evt := subscription.Recv()
 
-		tx, err := p.svc.GetBD().BeginTx(ctx, nil)
-		if err != nil {
-			panic(err)
-		}
-
-		defer tx.Rollback()
-
-		if evt.EventAppeared != nil {
-			event, err := p.store.GetMarshaller().FromRecordedEvent(evt.EventAppeared.Event)
-			if err != nil {
-				log.Println(err)
-			}
-
-			err = handleEventFunc(ctx, event, tx)
-			if err != nil {
-				return err
-			}
-
-			if evt.CheckPointReached == nil {
-				err = p.subscriptionManager.SaveCheckpoint(p.projectionName, &evt.EventAppeared.OriginalEvent().Position, tx)
-				if err != nil {
-					panic(err)
-				}
+		if evt.SubscriptionDropped != nil {
+			if ctx.Err() != nil {
+				break
 			}
 
-			log.Printf("Processed event %s@%s\n", evt.EventAppeared.Event.EventType, evt.EventAppeared.Event.EventID)
+			return fmt.Errorf("subscription %s dropped: %w", subscriptionID, evt.SubscriptionDropped.Error)
 		}
 
-		if evt.CheckPointReached != nil {
-			err = p.subscriptionManager.SaveCheckpoint(p.projectionName, evt.CheckPointReached, tx)
-			if err != nil {
-				panic(err)
+		if err := p.projectEvent(ctx, evt, subscriptionID, handleEventFunc); err != nil {
+			if ctx.Err() != nil {
+				break
 			}
-		}
 
-		if evt.SubscriptionDropped != nil {
-			log.Printf("subscription dropped: %v", evt.SubscriptionDropped.Error)
-			break
+			return err
 		}
-
-		tx.Commit()
 	}
 
+	log.Printf("Projection %s stopped\n", p.projectionName)
+
 	return nil
 }
 
-func (p *Projection) handleEventsFromPersistentSubscription(ctx context.Context, subscription *esdb.PersistentSubscription, handleEventFunc EventProjectionHandleFunc) (err error) {
-	defer subscription.Close()
+// handleEvent projects and checkpoints a subscription event in a single
+// transaction. Persistent subscriptions are acknowledged by the server, so
+// only their checkpoints are saved. The transaction is not bound to the
+// cancellation of ctx, so a shutdown lets the event in flight commit.
+func (p *Projection) handleEvent(ctx context.Context, evt *esourcing.SubscriptionEvent, subscriptionID string, handleEventFunc EventProjectionHandleFunc) error {
+	ctx = context.WithoutCancel(ctx)
 
-	for {
-		evt := subscription.Recv()
+	tx, err := p.svc.GetBD().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
-		tx, err := p.svc.GetBD().BeginTx(ctx, nil)
-		if err != nil {
-			panic(err)
-		}
+	defer tx.Rollback()
 
-		defer tx.Rollback()
+	position := evt.CheckpointReached
 
-		if evt.EventAppeared != nil {
-			event, err := p.store.GetMarshaller().FromRecordedEvent(evt.EventAppeared.Event)
-			if err != nil {
-				log.Println(err)
-			}
+	if evt.EventAppeared != nil {
+		event, err := p.store.GetMarshaller().FromRecordedEvent(ctx, evt.EventAppeared)
+		if err != nil {
+			return Poison(err)
+		}
 
-			err = handleEventFunc(ctx, event, tx)
-			if err != nil {
-				return err
-			}
+		eventCtx := esourcing.ContextFromEvent(ctx, event)
 
-			log.Printf("Processed event %s@%s\n", evt.EventAppeared.Event.EventType, evt.EventAppeared.Event.EventID)
+		err = handleEventFunc(eventCtx, event, tx)
+		if err != nil {
+			return err
 		}
 
-		if evt.CheckPointReached != nil {
-			err = p.subscriptionManager.SaveCheckpoint(projectionName, evt.CheckPointReached, tx)
-			if err != nil {
-				panic(err)
-			}
+		if position == nil && !p.isPersistent {
+			position = &evt.EventAppeared.Position
 		}
 
-		if evt.SubscriptionDropped != nil {
-			log.Printf("subscription dropped: %v", evt.SubscriptionDropped.Error)
-			break
-		}
+		log.Printf("Processed event %s@%s correlation=%s\n", evt.EventAppeared.EventType, evt.EventAppeared.EventID, esourcing.EventMetadataFromContext(eventCtx).CorrelationID)
+	}
 
-		tx.Commit()
+	if position != nil {
+		err = p.subscriptionManager.SaveCheckpoint(subscriptionID, position, tx)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return tx.Commit()
 }
@@ -0,0 +1,144 @@
+package projection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/feralc/golang-sp-2024-eventsourcing/infrastructure/migration"
+)
+
+// ProjectionSchema describes the read model tables of a projection, so a new
+// version of it can be built into its own tables alongside the live ones.
+// Version 1 uses the plain table names and the projection name as checkpoint,
+// later versions add a _v<version> suffix to both.
+type ProjectionSchema struct {
+	Name string
+	// Tables are created in order and dropped in reverse order, so tables
+	// referenced by foreign keys come first.
+	Tables []ProjectionTable
+}
+
+// ProjectionTable is a table of a projection. Its Create statement refers to
+// the tables of the projection as {table}, e.g. "CREATE TABLE IF NOT EXISTS
+// {shopping_cart}", and must not fail when the table exists.
+type ProjectionTable struct {
+	Name   string
+	Create string
+}
+
+// Table returns the name of table in the given version of the projection.
+func (s ProjectionSchema) Table(table string, version int) string {
+	if version <= 1 {
+		return table
+	}
+
+	return fmt.Sprintf("%s_v%d", table, version)
+}
+
+// SubscriptionID returns the checkpoint of the given version of the projection.
+func (s ProjectionSchema) SubscriptionID(version int) string {
+	if version <= 1 {
+		return s.Name
+	}
+
+	return fmt.Sprintf("%s_v%d", s.Name, version)
+}
+
+// Migrations create the tables of the first version of the projection,
+// owned by the projection. Later versions are created by Rebuild from the
+// current Create statements, and the tables of version 1 dropped, so once a
+// projection was rebuilt its schema_migration rows describe tables that no
+// longer exist.
+//
+// A later change to the read model therefore updates the Create statement,
+// for the next rebuild, and appends a migration altering the tables of the
+// active version, looked up in the migration transaction:
+//
+//	Up: func(ctx context.Context, tx *sql.Tx) error {
+//		version, err := ActiveVersion(ctx, tx, s.Name)
+//		if err != nil {
+//			return err
+//		}
+//
+//		_, err = tx.ExecContext(ctx, "ALTER TABLE "+s.Table("shopping_cart", version)+" ADD COLUMN ...")
+//		return err
+//	},
+//
+// Such migrations must not run during a rebuild, whose tables were created
+// from the previous Create statements.
+func (s ProjectionSchema) Migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Owner:       s.Name,
+			Version:     1,
+			Description: "create read model tables",
+			Up: func(ctx context.Context, tx *sql.Tx) error {
+				return s.createTables(ctx, tx, 1)
+			},
+		},
+	}
+}
+
+func (s ProjectionSchema) createTables(ctx context.Context, tx *sql.Tx, version int) error {
+	replacements := []string{}
+
+	for _, table := range s.Tables {
+		replacements = append(replacements, "{"+table.Name+"}", s.Table(table.Name, version))
+	}
+
+	replacer := strings.NewReplacer(replacements...)
+
+	for _, table := range s.Tables {
+		if _, err := tx.ExecContext(ctx, replacer.Replace(table.Create)); err != nil {
+			return fmt.Errorf("error when creating table %s: %w", s.Table(table.Name, version), err)
+		}
+	}
+
+	return nil
+}
+
+func (s ProjectionSchema) dropTables(ctx context.Context, tx *sql.Tx, version int) error {
+	for i := len(s.Tables) - 1; i >= 0; i-- {
+		table := s.Table(s.Tables[i].Name, version)
+
+		if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+			return fmt.Errorf("error when dropping table %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// ActiveVersion returns the version of the projection the query side reads
+// from, 1 until a rebuild switches to another one. It share-locks the version,
+// so reading or writing the tables in the same transaction cannot race with a
+// switch and the drop of the previous tables.
+func ActiveVersion(ctx context.Context, tx *sql.Tx, projectionName string) (int, error) {
+	var version int
+
+	row := tx.QueryRowContext(ctx, "SELECT active_version FROM es_projection_version WHERE projection_name = ? LOCK IN SHARE MODE", projectionName)
+	err := row.Scan(&version)
+
+	if err == sql.ErrNoRows {
+		return 1, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("error when reading version of projection %s: %w", projectionName, err)
+	}
+
+	return version, nil
+}
+
+func switchVersion(ctx context.Context, tx *sql.Tx, projectionName string, version int) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO es_projection_version (projection_name, active_version) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE active_version = VALUES(active_version)`, projectionName, version)
+
+	if err != nil {
+		return fmt.Errorf("error when switching projection %s to version %d: %w", projectionName, version, err)
+	}
+
+	return nil
+}
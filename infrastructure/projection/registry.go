@@ -0,0 +1,82 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+)
+
+var ErrProjectionNotFound = fmt.Errorf("projection not found")
+
+// Runner is a projection run by the Supervisor. Run blocks until ctx is
+// cancelled, returning nil, or the projection fails.
+type Runner interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+// Rebuilder is a Runner whose read model can be rebuilt from the event log.
+type Rebuilder interface {
+	Runner
+	Rebuild(ctx context.Context) error
+}
+
+// DeadLetterHandler is a Runner whose parked events can be listed, retried
+// and discarded.
+type DeadLetterHandler interface {
+	Runner
+	DeadLetters(ctx context.Context) ([]DeadLetter, error)
+	RetryDeadLetter(ctx context.Context, id int64) error
+	DiscardDeadLetter(ctx context.Context, id int64) error
+}
+
+// Registry holds the projections of the process by name.
+type Registry struct {
+	runners []Runner
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(runners ...Runner) error {
+	for _, runner := range runners {
+		if _, err := r.Get(runner.Name()); err == nil {
+			return fmt.Errorf("projection %s is already registered", runner.Name())
+		}
+
+		r.runners = append(r.runners, runner)
+	}
+
+	return nil
+}
+
+func (r *Registry) Get(name string) (Runner, error) {
+	for _, runner := range r.runners {
+		if runner.Name() == name {
+			return runner, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrProjectionNotFound, name)
+}
+
+// Select returns the projections with the given names, or all of them in
+// registration order when no name is given.
+func (r *Registry) Select(names ...string) ([]Runner, error) {
+	if len(names) == 0 {
+		return r.runners, nil
+	}
+
+	runners := make([]Runner, len(names))
+
+	for i, name := range names {
+		runner, err := r.Get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		runners[i] = runner
+	}
+
+	return runners, nil
+}
@@ -0,0 +1,134 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+	"github.com/go-sql-driver/mysql"
+)
+
+// RetryPolicy decides how a projection handles the errors of its handler.
+// Transient errors are retried with exponential backoff and fail the
+// projection once MaxAttempts is reached, leaving the restart to the
+// Supervisor. Poison events, which fail the same way on every attempt, are
+// parked as dead letters and the projection carries on with the next event.
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	// IsPoison classifies errors, IsPoison by default.
+	IsPoison func(err error) bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	IsPoison:    IsPoison,
+}
+
+// PoisonError marks an error a handler returns whenever it handles the event,
+// like invalid data, so retrying it is pointless.
+type PoisonError struct {
+	Err error
+}
+
+func (e PoisonError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PoisonError) Unwrap() error {
+	return e.Err
+}
+
+// Poison marks err as a PoisonError.
+func Poison(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return PoisonError{Err: err}
+}
+
+// IsPoison reports whether err is a PoisonError or MySQL rejecting the data
+// written by the handler. Any other error is deemed transient. Duplicate
+// entries are not poison, handlers are expected to be idempotent instead, as
+// events are delivered at least once.
+func IsPoison(err error) bool {
+	var poisonErr PoisonError
+
+	if errors.As(err, &poisonErr) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		// Column cannot be null, out of range, incorrect value, data too
+		// long, foreign key constraint fails.
+		case 1048, 1264, 1366, 1406, 1451, 1452:
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = DefaultRetryPolicy.MinBackoff
+	}
+
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = max(DefaultRetryPolicy.MaxBackoff, p.MinBackoff)
+	}
+
+	if p.IsPoison == nil {
+		p.IsPoison = IsPoison
+	}
+
+	return p
+}
+
+// projectEvent handles a subscription event following the retry policy of the
+// projection.
+func (p *Projection) projectEvent(ctx context.Context, evt *esourcing.SubscriptionEvent, subscriptionID string, handleEventFunc EventProjectionHandleFunc) error {
+	backoff := p.retryPolicy.MinBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := p.handleEvent(ctx, evt, subscriptionID, handleEventFunc)
+
+		if err == nil || errors.Is(err, errVersionSwitched) {
+			return err
+		}
+
+		if evt.EventAppeared != nil && p.retryPolicy.IsPoison(err) {
+			log.Printf("Parking event %s@%s of projection %s: %v\n", evt.EventAppeared.EventType, evt.EventAppeared.EventID, p.projectionName, err)
+
+			return p.parkEvent(ctx, evt.EventAppeared, subscriptionID, attempt, err)
+		}
+
+		if attempt >= p.retryPolicy.MaxAttempts {
+			return fmt.Errorf("error after %d attempts: %w", attempt, err)
+		}
+
+		log.Printf("Retrying event of projection %s in %s (attempt %d of %d): %v\n", p.projectionName, backoff, attempt, p.retryPolicy.MaxAttempts, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff = min(backoff*2, p.retryPolicy.MaxBackoff)
+	}
+}
@@ -6,52 +6,156 @@ import (
 	"log"
 
 	"github.com/feralc/golang-sp-2024-eventsourcing/application/service"
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/event"
 	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
 )
 
 type ShoppingCartProjection struct {
-	svc        *service.Service
-	projection *Projection
+	svc          *service.Service
+	projection   *Projection
+	streamNaming esourcing.StreamNaming
 }
 
 const projectionName = "shopping-cart-projection"
 
-func NewShoppingCartProjection(svc *service.Service, store esourcing.EventStore) *ShoppingCartProjection {
+// ShoppingCartSchema is the read model of the shopping cart projection.
+var ShoppingCartSchema = ProjectionSchema{
+	Name: projectionName,
+	Tables: []ProjectionTable{
+		{
+			Name: "shopping_cart",
+			Create: `CREATE TABLE IF NOT EXISTS {shopping_cart} (
+				cart_id VARCHAR(255) PRIMARY KEY,
+				total DECIMAL(10,2) DEFAULT 0.0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			Name: "shopping_cart_item",
+			Create: `CREATE TABLE IF NOT EXISTS {shopping_cart_item} (
+				cart_id VARCHAR(255) NOT NULL,
+				product_id VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				quantity INT NOT NULL,
+				price DECIMAL(10,2) NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (cart_id, product_id),
+				FOREIGN KEY (cart_id) REFERENCES {shopping_cart}(cart_id)
+			);`,
+		},
+	},
+}
+
+// ShoppingCartTables are the table names of one version of the shopping cart
+// read model.
+type ShoppingCartTables struct {
+	Cart string
+	Item string
+}
+
+func ShoppingCartTablesFor(version int) ShoppingCartTables {
+	return ShoppingCartTables{
+		Cart: ShoppingCartSchema.Table("shopping_cart", version),
+		Item: ShoppingCartSchema.Table("shopping_cart_item", version),
+	}
+}
+
+// ActiveShoppingCartTables returns the tables the query side must read in tx,
+// see ActiveVersion.
+func ActiveShoppingCartTables(ctx context.Context, tx *sql.Tx) (ShoppingCartTables, error) {
+	version, err := ActiveVersion(ctx, tx, projectionName)
+
+	if err != nil {
+		return ShoppingCartTables{}, err
+	}
+
+	return ShoppingCartTablesFor(version), nil
+}
+
+// NewShoppingCartProjection subscribes to the shopping cart streams, named
+// with streamNaming like the cart repository does.
+func NewShoppingCartProjection(svc *service.Service, store esourcing.EventStore, streamNaming esourcing.StreamNaming) *ShoppingCartProjection {
 	return &ShoppingCartProjection{
-		svc:        svc,
-		projection: NewProjection(svc, store, projectionName),
+		svc:          svc,
+		projection:   NewVersionedProjection(svc, store, ShoppingCartSchema),
+		streamNaming: streamNaming,
 	}
 }
 
-func (p *ShoppingCartProjection) Run(ctx context.Context) {
+// WithRetryPolicy replaces the retry policy of the projection, see
+// Projection.WithRetryPolicy.
+func (p *ShoppingCartProjection) WithRetryPolicy(policy RetryPolicy) *ShoppingCartProjection {
+	p.projection.WithRetryPolicy(policy)
+	return p
+}
+
+func (p *ShoppingCartProjection) Run(ctx context.Context) error {
 	log.Println("Shopping cart projection started...")
 
-	p.projection.Run(ctx, []string{
-		"ShoppingCartCreated",
-		"ShoppingCartItemAdded",
-		"ShoppingCartItemRemoved",
-		"ShoppingCartCheckedOut",
-	}, p.handleShoppingCartEvent)
-}
-
-func (p *ShoppingCartProjection) handleShoppingCartEvent(ctx context.Context, evt esourcing.Event, tx *sql.Tx) (err error) {
-	switch evt := evt.(type) {
-	case event.ShoppingCartCreated:
-		err = HandleShoppingCartCreated(tx, evt)
-	case event.ShoppingCartItemAdded:
-		err = HandleShoppingCartItemAdded(tx, evt)
-	case event.ShoppingCartItemRemoved:
-		err = HandleShoppingCartItemRemoved(tx, evt)
-	case event.ShoppingCartCheckedOut:
-		err = HandleShoppingCartCheckedOut(tx, evt)
-	}
+	return p.projection.RunVersioned(ctx, p.filter(), p.handlerFor)
+}
 
-	return err
+func (p *ShoppingCartProjection) Name() string {
+	return projectionName
 }
 
-func HandleShoppingCartCreated(tx *sql.Tx, e event.ShoppingCartCreated) error {
-	_, err := tx.Exec("INSERT INTO shopping_cart (cart_id, created_at) VALUES (?,?);",
+// Rebuild builds a new version of the shopping cart read model from the cart
+// streams and switches to it once caught up.
+func (p *ShoppingCartProjection) Rebuild(ctx context.Context) error {
+	return p.projection.Rebuild(ctx, p.filter(), p.handlerFor)
+}
+
+func (p *ShoppingCartProjection) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	return p.projection.DeadLetters(ctx)
+}
+
+// RetryDeadLetter projects a parked event into the active version of the read
+// model.
+func (p *ShoppingCartProjection) RetryDeadLetter(ctx context.Context, id int64) error {
+	return p.projection.RetryDeadLetter(ctx, id, func(ctx context.Context, evt esourcing.Event, tx *sql.Tx) error {
+		version, err := ActiveVersion(ctx, tx, projectionName)
+		if err != nil {
+			return err
+		}
+
+		return p.handlerFor(version)(ctx, evt, tx)
+	})
+}
+
+func (p *ShoppingCartProjection) DiscardDeadLetter(ctx context.Context, id int64) error {
+	return p.projection.DiscardDeadLetter(ctx, id)
+}
+
+func (p *ShoppingCartProjection) filter() *esourcing.SubscriptionFilter {
+	return p.streamNaming.CategoryFilter(string(entity.ShoppingCartAggregateType))
+}
+
+func (p *ShoppingCartProjection) handlerFor(version int) EventProjectionHandleFunc {
+	tables := ShoppingCartTablesFor(version)
+
+	return func(ctx context.Context, evt esourcing.Event, tx *sql.Tx) (err error) {
+		switch evt := evt.(type) {
+		case event.ShoppingCartCreated:
+			err = HandleShoppingCartCreated(tx, tables, evt)
+		case event.ShoppingCartItemAdded:
+			err = HandleShoppingCartItemAdded(tx, tables, evt)
+		case event.ShoppingCartItemRemoved:
+			err = HandleShoppingCartItemRemoved(tx, tables, evt)
+		case event.ShoppingCartCheckedOut:
+			err = HandleShoppingCartCheckedOut(tx, tables, evt)
+		case event.ShoppingCartDeleted:
+			err = HandleShoppingCartDeleted(tx, tables, evt)
+		}
+
+		return err
+	}
+}
+
+func HandleShoppingCartCreated(tx *sql.Tx, tables ShoppingCartTables, e event.ShoppingCartCreated) error {
+	// Events may be delivered more than once, an existing cart is kept as it
+	// is.
+	_, err := tx.Exec("INSERT INTO "+tables.Cart+" (cart_id, created_at) VALUES (?,?) ON DUPLICATE KEY UPDATE cart_id = cart_id;",
 		e.AggregateID(),
 		e.Timestamp(),
 	)
@@ -63,9 +167,9 @@ func HandleShoppingCartCreated(tx *sql.Tx, e event.ShoppingCartCreated) error {
 	return nil
 }
 
-func HandleShoppingCartItemAdded(tx *sql.Tx, e event.ShoppingCartItemAdded) error {
+func HandleShoppingCartItemAdded(tx *sql.Tx, tables ShoppingCartTables, e event.ShoppingCartItemAdded) error {
 	_, err := tx.Exec(`
-		INSERT INTO shopping_cart_item (cart_id, product_id, name, quantity, price, created_at) 
+		INSERT INTO `+tables.Item+` (cart_id, product_id, name, quantity, price, created_at) 
 		VALUES (?, ?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE
 			quantity = quantity + VALUES(quantity),
@@ -84,11 +188,11 @@ func HandleShoppingCartItemAdded(tx *sql.Tx, e event.ShoppingCartItemAdded) erro
 		return err
 	}
 
-	return updateTotal(tx, e.AggregateID())
+	return updateTotal(tx, tables, e.AggregateID())
 }
 
-func HandleShoppingCartItemRemoved(tx *sql.Tx, e event.ShoppingCartItemRemoved) error {
-	_, err := tx.Exec("DELETE FROM shopping_cart_item WHERE cart_id = ? AND product_id = ?;",
+func HandleShoppingCartItemRemoved(tx *sql.Tx, tables ShoppingCartTables, e event.ShoppingCartItemRemoved) error {
+	_, err := tx.Exec("DELETE FROM "+tables.Item+" WHERE cart_id = ? AND product_id = ?;",
 		e.AggregateID(),
 		e.ProductID,
 	)
@@ -97,35 +201,43 @@ func HandleShoppingCartItemRemoved(tx *sql.Tx, e event.ShoppingCartItemRemoved)
 		return err
 	}
 
-	return updateTotal(tx, e.AggregateID())
+	return updateTotal(tx, tables, e.AggregateID())
 }
 
-func HandleShoppingCartCheckedOut(tx *sql.Tx, e event.ShoppingCartCheckedOut) error {
-	_, err := tx.Exec("DELETE FROM shopping_cart_item WHERE cart_id = ?;",
-		e.AggregateID(),
+func HandleShoppingCartCheckedOut(tx *sql.Tx, tables ShoppingCartTables, e event.ShoppingCartCheckedOut) error {
+	return deleteCart(tx, tables, e.AggregateID())
+}
+
+func HandleShoppingCartDeleted(tx *sql.Tx, tables ShoppingCartTables, e event.ShoppingCartDeleted) error {
+	return deleteCart(tx, tables, e.AggregateID())
+}
+
+func deleteCart(tx *sql.Tx, tables ShoppingCartTables, cartID string) error {
+	_, err := tx.Exec("DELETE FROM "+tables.Item+" WHERE cart_id = ?;",
+		cartID,
 	)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec("DELETE FROM shopping_cart WHERE cart_id = ?;",
-		e.AggregateID(),
+	_, err = tx.Exec("DELETE FROM "+tables.Cart+" WHERE cart_id = ?;",
+		cartID,
 	)
 
 	return err
 }
 
-func updateTotal(tx *sql.Tx, cartID string) error {
+func updateTotal(tx *sql.Tx, tables ShoppingCartTables, cartID string) error {
 	var total float64
 
-	row := tx.QueryRow("SELECT COALESCE(SUM(quantity * price), 0) FROM shopping_cart_item WHERE cart_id = ?;", cartID)
+	row := tx.QueryRow("SELECT COALESCE(SUM(quantity * price), 0) FROM "+tables.Item+" WHERE cart_id = ?;", cartID)
 	err := row.Scan(&total)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec("UPDATE shopping_cart SET total = ? WHERE cart_id = ?;",
+	_, err = tx.Exec("UPDATE "+tables.Cart+" SET total = ? WHERE cart_id = ?;",
 		total,
 		cartID,
 	)
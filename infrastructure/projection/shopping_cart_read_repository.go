@@ -0,0 +1,96 @@
+package projection
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/repository"
+)
+
+type shoppingCartReadRepository struct {
+	db *sql.DB
+}
+
+// NewShoppingCartReadRepository returns a repository reading the tables of the
+// active version of the shopping cart projection.
+func NewShoppingCartReadRepository(db *sql.DB) repository.ShoppingCartReadRepository {
+	return &shoppingCartReadRepository{
+		db: db,
+	}
+}
+
+// All holds the active version for the duration of the query, so a projection
+// rebuild cannot drop its tables meanwhile.
+func (r *shoppingCartReadRepository) All(ctx context.Context) ([]repository.ShoppingCartView, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tables, err := ActiveShoppingCartTables(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT
+			c.cart_id,
+			c.total,
+			i.product_id,
+			i.name,
+			i.quantity,
+			i.price
+		FROM
+			` + tables.Cart + ` c
+		LEFT JOIN
+			` + tables.Item + ` i ON c.cart_id = i.cart_id
+		ORDER BY
+			c.cart_id
+	`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	carts := []repository.ShoppingCartView{}
+
+	for rows.Next() {
+		var cartID string
+		var total sql.NullFloat64
+		var productID sql.NullString
+		var productName sql.NullString
+		var quantity sql.NullInt32
+		var price sql.NullFloat64
+
+		if err := rows.Scan(&cartID, &total, &productID, &productName, &quantity, &price); err != nil {
+			return nil, err
+		}
+
+		if len(carts) == 0 || carts[len(carts)-1].CartID != cartID {
+			carts = append(carts, repository.ShoppingCartView{
+				CartID: cartID,
+				Total:  total.Float64,
+				Items:  []repository.ShoppingCartItemView{},
+			})
+		}
+
+		if productID.Valid {
+			cart := &carts[len(carts)-1]
+			cart.Items = append(cart.Items, repository.ShoppingCartItemView{
+				ProductID: productID.String,
+				Name:      productName.String,
+				Price:     price.Float64,
+				Quantity:  int(quantity.Int32),
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return carts, tx.Commit()
+}
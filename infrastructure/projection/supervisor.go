@@ -0,0 +1,106 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type SupervisorConfig struct {
+	// MinBackoff is how long a failed projection waits before its first
+	// restart. The wait doubles on each consecutive failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// A projection that ran for at least ResetAfter before failing is restarted
+	// after MinBackoff again.
+	ResetAfter time.Duration
+}
+
+// Supervisor runs projections concurrently and restarts the ones that fail,
+// so a crashing projection does not stop the others.
+type Supervisor struct {
+	config  SupervisorConfig
+	runners []Runner
+}
+
+func NewSupervisor(config SupervisorConfig, runners ...Runner) *Supervisor {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = max(time.Minute, config.MinBackoff)
+	}
+
+	if config.ResetAfter <= 0 {
+		config.ResetAfter = time.Minute
+	}
+
+	return &Supervisor{
+		config:  config,
+		runners: runners,
+	}
+}
+
+// Run blocks until ctx is cancelled and every projection has stopped.
+func (s *Supervisor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, runner := range s.runners {
+		wg.Add(1)
+
+		go func(runner Runner) {
+			defer wg.Done()
+
+			s.supervise(ctx, runner)
+		}(runner)
+	}
+
+	wg.Wait()
+}
+
+func (s *Supervisor) supervise(ctx context.Context, runner Runner) {
+	backoff := s.config.MinBackoff
+
+	for {
+		started := time.Now()
+		err := s.run(ctx, runner)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("projection returned before shutdown")
+		}
+
+		if time.Since(started) >= s.config.ResetAfter {
+			backoff = s.config.MinBackoff
+		}
+
+		log.Printf("Projection %s failed, restarting in %s: %v\n", runner.Name(), backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff = min(backoff*2, s.config.MaxBackoff)
+	}
+}
+
+// run turns a panic of the projection into an error, so it is restarted
+// instead of crashing the process.
+func (s *Supervisor) run(ctx context.Context, runner Runner) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return runner.Run(ctx)
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/feralc/golang-sp-2024-eventsourcing/api"
 	"github.com/feralc/golang-sp-2024-eventsourcing/application/service"
+	"github.com/feralc/golang-sp-2024-eventsourcing/domain/entity"
 	"github.com/feralc/golang-sp-2024-eventsourcing/domain/event"
 	"github.com/feralc/golang-sp-2024-eventsourcing/esourcing"
+	"github.com/feralc/golang-sp-2024-eventsourcing/infrastructure/migration"
 	"github.com/feralc/golang-sp-2024-eventsourcing/infrastructure/persistence"
 	"github.com/feralc/golang-sp-2024-eventsourcing/infrastructure/projection"
 	_ "github.com/go-sql-driver/mysql"
@@ -26,25 +34,6 @@ func main() {
 
 	godotenv.Load()
 
-	eventstoreHost := os.Getenv("EVENTSTORE_HOST")
-	eventstoreUsername := os.Getenv("EVENTSTORE_USER")
-	eventstorePassword := os.Getenv("EVENTSTORE_PASS")
-
-	store, err := esourcing.NewEventStore(esourcing.EventStoreConfig{
-		Host:     eventstoreHost,
-		Username: eventstoreUsername,
-		Password: eventstorePassword,
-	})
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	store.RegisterEventType((*event.ShoppingCartCreated)(nil))
-	store.RegisterEventType((*event.ShoppingCartItemAdded)(nil))
-	store.RegisterEventType((*event.ShoppingCartItemRemoved)(nil))
-	store.RegisterEventType((*event.ShoppingCartCheckedOut)(nil))
-
 	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
 		os.Getenv("DB_USER"),
 		os.Getenv("DB_PASS"),
@@ -58,9 +47,76 @@ func main() {
 
 	defer db.Close()
 
-	err = setupDatabase(db)
+	ctx := context.Background()
+
+	migrator, err := newMigrator(db)
 	if err != nil {
-		log.Fatalf("Error setting up database: %v", err)
+		log.Fatal(err)
+	}
+
+	switch os.Args[1] {
+	case "db:migrate":
+		applied, err := migrator.Migrate(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Applied %d migrations", len(applied))
+		return
+
+	case "db:status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Printf("%s\t%d\t%s\t%s\n", status.Migration.Owner, status.Migration.Version, status.Migration.Description, appliedAt)
+		}
+		return
+	}
+
+	// Processes never change the schema themselves, it is migrated beforehand
+	// with db:migrate.
+	if err := migrator.RequireMigrated(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := newEventStore(db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := event.RegisterEventTypes(store); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := esourcing.VerifyHandlers(entity.NewEmptyShoppingCart(""), event.ShoppingCartEventTypes()...); err != nil {
+		log.Fatal(err)
+	}
+
+	keyStore := esourcing.NewSQLKeyStore(db)
+
+	marshaller := store.GetMarshaller()
+	marshaller.RegisterSerializer(esourcing.NewProtobufSerializer())
+	marshaller.EncryptPersonalData(keyStore)
+	// Gzip halves payloads from about 256 bytes on, below that it saves a few
+	// bytes at best, see BenchmarkGzipPayloadSize. Cart events stay under it.
+	marshaller.CompressPayloads(esourcing.NewGzipCompressor(gzip.BestSpeed), 256)
+
+	if err := marshaller.UseSerializer(event.ShoppingCartItemAddedName, esourcing.ProtobufContentType); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := marshaller.ValidateUpcasters(); err != nil {
+		log.Fatal(err)
 	}
 
 	svc, err := service.New(db)
@@ -69,9 +125,38 @@ func main() {
 		panic(err)
 	}
 
-	ctx := context.Background()
+	// Existing streams keep the separator they were written with, only switch
+	// to "-" for EventStoreDB $ce- category projections on a fresh store.
+	streamNaming := esourcing.StreamNaming{Separator: os.Getenv("STREAM_SEPARATOR")}
+
+	snapshotStore, err := newSnapshotStore(db, store, streamNaming)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cartRepositoryConfig := esourcing.RepositoryConfig{
+		StreamNaming:  streamNaming,
+		SnapshotStore: snapshotStore,
+		SnapshotPolicy: esourcing.AnySnapshotPolicy(
+			esourcing.SnapshotEvery(100),
+			esourcing.SnapshotOn(event.ShoppingCartCheckedOutName),
+		),
+	}
+
+	// Carts not checked out within CART_MAX_AGE of their creation are
+	// abandoned and scavenged by EventStoreDB, checked out carts are kept.
+	if maxAge := os.Getenv("CART_MAX_AGE"); maxAge != "" {
+		duration, err := time.ParseDuration(maxAge)
+
+		if err != nil {
+			log.Fatalf("Invalid CART_MAX_AGE: %v", err)
+		}
 
-	cartRepository := persistence.NewEventSourcedShoppingCartRepository(store)
+		cartRepositoryConfig.StreamMetadata = esourcing.StreamMaxAgeUntil(duration, event.ShoppingCartCheckedOutName)
+	}
+
+	cartRepository := persistence.NewEventSourcedShoppingCartRepositoryWithConfig(store, cartRepositoryConfig)
 	productRepository := persistence.NewInMemoryProductRepository()
 	shoppingCartService := service.NewShoppingCartService(cartRepository, productRepository)
 
@@ -83,60 +168,266 @@ func main() {
 		e := echo.New()
 
 		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-			AllowOrigins: []string{"*"},
-			AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+			AllowOrigins:  []string{"*"},
+			AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, api.HeaderCorrelationID, api.HeaderUserID, api.HeaderIfMatch},
+			ExposeHeaders: []string{api.HeaderCorrelationID, api.HeaderETag},
 		}))
+		e.Use(api.EventMetadataMiddleware())
 
 		e.POST("/shopping-cart", api.CreateShoppingCartHandler(shoppingCartService))
 		e.POST("/shopping-cart/:cartID/item", api.AddItemHandler(shoppingCartService))
 		e.DELETE("/shopping-cart/:cartID/item/:productID", api.RemoveItemHandler(shoppingCartService))
 		e.POST("/shopping-cart/:cartID/checkout", api.CheckoutHandler(shoppingCartService))
 		e.GET("/shopping-cart/:cartID", api.GetShoppingCartHandler(cartRepository))
-		e.GET("/shopping-carts", api.GetAllShoppingCartsHandler(db))
+		e.GET("/shopping-carts", api.GetAllShoppingCartsHandler(projection.NewShoppingCartReadRepository(db)))
 
 		e.GET("/products", api.GetAllProductsHandler(productRepository))
 
 		e.Logger.Fatal(e.Start(":8080"))
 
 	case "start:projection":
-		personProjection := projection.NewShoppingCartProjection(svc, store)
-		personProjection.Run(ctx)
+		projections, err := newProjectionRegistry(svc, store, streamNaming)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		runners, err := projections.Select(os.Args[2:]...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// On SIGTERM, projections commit the event in flight and stop.
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		projection.NewSupervisor(projection.SupervisorConfig{}, runners...).Run(ctx)
+
+		log.Println("Projections stopped")
+
+	case "projection:rebuild":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: projection:rebuild <name>")
+		}
+
+		projections, err := newProjectionRegistry(svc, store, streamNaming)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		runner, err := projections.Get(os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		rebuilder, ok := runner.(projection.Rebuilder)
+		if !ok {
+			log.Fatalf("Projection %s cannot be rebuilt", runner.Name())
+		}
+
+		if err := rebuilder.Rebuild(ctx); err != nil {
+			log.Fatal(err)
+		}
+
+	case "projection:dead-letters":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: projection:dead-letters <name>")
+		}
+
+		handler, err := newDeadLetterHandler(svc, store, streamNaming, os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		deadLetters, err := handler.DeadLetters(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, deadLetter := range deadLetters {
+			fmt.Printf("%d\t%s\t%s@%s\t%s\t%d:%d\tattempts=%d\t%s\n",
+				deadLetter.ID,
+				deadLetter.ParkedAt.Format(time.RFC3339),
+				deadLetter.Event.EventType,
+				deadLetter.Event.EventID,
+				deadLetter.Event.StreamID,
+				deadLetter.Event.Position.Prepare,
+				deadLetter.Event.Position.Commit,
+				deadLetter.Attempts,
+				deadLetter.Error,
+			)
+		}
+
+	case "projection:dead-letters:retry", "projection:dead-letters:discard":
+		if len(os.Args) < 4 {
+			log.Fatalf("Usage: %s <name> <id|all>", cmd)
+		}
+
+		handler, err := newDeadLetterHandler(svc, store, streamNaming, os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ids := []int64{}
+
+		if os.Args[3] == "all" {
+			deadLetters, err := handler.DeadLetters(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			for _, deadLetter := range deadLetters {
+				ids = append(ids, deadLetter.ID)
+			}
+		} else {
+			id, err := strconv.ParseInt(os.Args[3], 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid dead letter ID %s", os.Args[3])
+			}
+
+			ids = append(ids, id)
+		}
+
+		failed := 0
+
+		for _, id := range ids {
+			if cmd == "projection:dead-letters:retry" {
+				err = handler.RetryDeadLetter(ctx, id)
+			} else {
+				err = handler.DiscardDeadLetter(ctx, id)
+			}
+
+			if err != nil {
+				log.Println(err)
+				failed++
+			}
+		}
+
+		log.Printf("Processed %d dead letters, %d failed", len(ids)-failed, failed)
+
+		if failed > 0 {
+			os.Exit(1)
+		}
+
+	case "subject:forget":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: subject:forget <subjectID>")
+		}
+
+		if err := keyStore.ForgetSubject(ctx, os.Args[2]); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Personal data of subject %s is no longer readable", os.Args[2])
+
+	case "cart:purge":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: cart:purge <cartID> [reason]")
+		}
+
+		reason := "purged by operator"
+
+		if len(os.Args) > 3 {
+			reason = strings.Join(os.Args[3:], " ")
+		}
+
+		if err := shoppingCartService.PurgeShoppingCart(ctx, os.Args[2], reason); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Shopping cart %s was deleted", os.Args[2])
+
+	case "events:list":
+		for _, registered := range store.RegisteredEventTypes() {
+			fmt.Printf("%s\t%s\t%s\n", registered.Name, registered.Type, strings.Join(registered.Aliases, ","))
+		}
 	}
 }
 
-func setupDatabase(db *sql.DB) error {
-	queries := []string{
-		`DROP TABLE IF EXISTS es_subscription_checkpoint;`,
-		`DROP TABLE IF EXISTS shopping_cart_item;`,
-		`DROP TABLE IF EXISTS shopping_cart;`,
-		`CREATE TABLE es_subscription_checkpoint (
-			subscription_id VARCHAR(255) PRIMARY KEY,
-			checkpoint_position VARCHAR(255),
-			checkpoint_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE TABLE shopping_cart (
-			cart_id VARCHAR(255) PRIMARY KEY,
-			total DECIMAL(10,2) DEFAULT 0.0,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE TABLE shopping_cart_item (
-			cart_id VARCHAR(255) NOT NULL,
-			product_id VARCHAR(255) NOT NULL,
-			name VARCHAR(255) NOT NULL,
-			quantity INT NOT NULL,
-			price DECIMAL(10,2) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (cart_id, product_id),
-			FOREIGN KEY (cart_id) REFERENCES shopping_cart(cart_id)
-		);`,
-	}
-
-	for _, query := range queries {
-		_, err := db.Exec(query)
-		if err != nil {
-			return fmt.Errorf("error executing query: %w", err)
+func newEventStore(db *sql.DB) (esourcing.EventStore, error) {
+	switch os.Getenv("EVENTSTORE_DRIVER") {
+	case "mysql":
+		return esourcing.NewSQLEventStore(db, esourcing.MySQLDialect, esourcing.SQLEventStoreConfig{}), nil
+	default:
+		return esourcing.NewEventStore(esourcing.EventStoreConfig{
+			Host:     os.Getenv("EVENTSTORE_HOST"),
+			Username: os.Getenv("EVENTSTORE_USER"),
+			Password: os.Getenv("EVENTSTORE_PASS"),
+		})
+	}
+}
+
+func newSnapshotStore(db *sql.DB, store esourcing.EventStore, streamNaming esourcing.StreamNaming) (esourcing.SnapshotStore, error) {
+	switch os.Getenv("EVENTSTORE_DRIVER") {
+	case "mysql":
+		return esourcing.NewSQLSnapshotStore(db, esourcing.MySQLDialect), nil
+	default:
+		return esourcing.NewEventStoreSnapshotStore(store, streamNaming)
+	}
+}
+
+func newProjectionRegistry(svc *service.Service, store esourcing.EventStore, streamNaming esourcing.StreamNaming) (*projection.Registry, error) {
+	retryPolicy := projection.DefaultRetryPolicy
+
+	// Handlers are attempted PROJECTION_MAX_ATTEMPTS times on transient errors
+	// before the projection fails and is restarted.
+	if maxAttempts := os.Getenv("PROJECTION_MAX_ATTEMPTS"); maxAttempts != "" {
+		attempts, err := strconv.Atoi(maxAttempts)
+
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("invalid PROJECTION_MAX_ATTEMPTS %q", maxAttempts)
+		}
+
+		retryPolicy.MaxAttempts = attempts
+	}
+
+	projections := projection.NewRegistry()
+
+	if err := projections.Register(projection.NewShoppingCartProjection(svc, store, streamNaming).WithRetryPolicy(retryPolicy)); err != nil {
+		return nil, err
+	}
+
+	return projections, nil
+}
+
+func newDeadLetterHandler(svc *service.Service, store esourcing.EventStore, streamNaming esourcing.StreamNaming, name string) (projection.DeadLetterHandler, error) {
+	projections, err := newProjectionRegistry(svc, store, streamNaming)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := projections.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	handler, ok := runner.(projection.DeadLetterHandler)
+	if !ok {
+		return nil, fmt.Errorf("projection %s does not park events", name)
+	}
+
+	return handler, nil
+}
+
+func newMigrator(db *sql.DB) (*migration.Migrator, error) {
+	migrator := migration.NewMigrator(db)
+
+	if err := migrator.Register(persistence.KeyStoreMigrations...); err != nil {
+		return nil, err
+	}
+
+	if os.Getenv("EVENTSTORE_DRIVER") == "mysql" {
+		if err := migrator.Register(persistence.SQLEventStoreMigrations...); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	if err := migrator.Register(projection.Migrations...); err != nil {
+		return nil, err
+	}
+
+	if err := migrator.Register(projection.ShoppingCartSchema.Migrations()...); err != nil {
+		return nil, err
+	}
+
+	return migrator, nil
 }